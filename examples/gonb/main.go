@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"os"
 	"strings"
 
 	"github.com/crackcomm/go-jupyter/jupyter"
@@ -77,5 +78,8 @@ func main() {
 	if err != nil {
 		log.Fatal(err)
 	}
-	fmt.Println(inspectRep.Data["text/markdown"])
+	if err := inspectRep.Render(os.Stdout); err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println()
 }
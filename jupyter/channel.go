@@ -0,0 +1,153 @@
+package jupyter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/go-zeromq/zmq4"
+)
+
+// Transient errors of receiving are retried up to transientRetries times,
+// doubling the delay after each failed attempt. Sends are not retried, a send failing
+// after some frames were written would deliver a duplicated or corrupted multipart message.
+const (
+	transientRetries = 3
+	transientDelay   = 10 * time.Millisecond
+)
+
+// channel is a kernel socket sending and receiving signed messages,
+// e.g. shell, control or iopub. The socket is replaced when the client reconnects.
+type channel struct {
+	name   string
+	client *Client
+
+	// Lock used to send messages on the socket and to replace it.
+	lock   *sync.Mutex
+	socket zmq4.Socket
+}
+
+func (client *Client) newChannel(name string) *channel {
+	return &channel{
+		name:   name,
+		client: client,
+		lock:   new(sync.Mutex),
+	}
+}
+
+// reset replaces the socket of the channel, the previous socket should be closed.
+func (ch *channel) reset(socket zmq4.Socket) {
+	ch.lock.Lock()
+	defer ch.lock.Unlock()
+	ch.socket = socket
+}
+
+// send encodes the message, signs it with the connection key and sends it on the socket.
+func (ch *channel) send(msg Message) error {
+	frames := [][]byte{[]byte("<IDS|MSG>")}
+	key, hash := ch.client.signing()
+	if ch.client.strict {
+		if err := msg.Header.Validate(); err != nil {
+			return err
+		}
+	}
+	encoded, err := msg.EncodeWith(key, hash)
+	if err != nil {
+		return fmt.Errorf("Error encoding message: %w", err)
+	}
+	frames = append(frames, encoded...)
+
+	ch.client.observe(ch.name+":send", frames)
+	ch.lock.Lock()
+	defer ch.lock.Unlock()
+	body := zmq4.NewMsgFrom(frames...)
+	if err := ch.socket.SendMulti(body); err != nil {
+		return fmt.Errorf("Error sending %s: %w", msg.Header.MsgType, err)
+	}
+	if ch == ch.client.shell || ch == ch.client.control {
+		ch.client.setLastRequest(msg)
+	}
+	return nil
+}
+
+// recv receives a message from the socket and decodes it, validating its signature.
+// Received frames are returned with an error of decoding, they are nil if receiving failed.
+func (ch *channel) recv(msg *RawMessage) (frames [][]byte, err error) {
+	ch.lock.Lock()
+	socket := ch.socket
+	ch.lock.Unlock()
+	var body zmq4.Msg
+	if err = retryTransient(func() (err error) {
+		body, err = socket.Recv()
+		return
+	}); err != nil {
+		return nil, err
+	}
+	ch.client.observe(ch.name+":recv", body.Frames)
+	key, hash := ch.client.signing()
+	err = msg.DecodeWith(body.Frames, key, hash)
+	ch.client.observeSignature(err)
+	if err == nil && ch.client.strict {
+		err = validateHeaders(msg)
+	}
+	if err != nil {
+		return body.Frames, fmt.Errorf("Error decoding %s message: %w", ch.name, err)
+	}
+	return body.Frames, nil
+}
+
+// validateHeaders validates the header of a received message and its parent header, if it has one.
+func validateHeaders(msg *RawMessage) error {
+	if err := msg.Header.Validate(); err != nil {
+		return err
+	}
+	if msg.ParentHeader.MsgID == "" {
+		// e.g. status messages published on startup have no parent
+		return nil
+	}
+	if err := msg.ParentHeader.Validate(); err != nil {
+		return fmt.Errorf("Parent header: %w", err)
+	}
+	return nil
+}
+
+// retryTransient calls op until it succeeds, fails with an error which is not transient
+// or the retries are exhausted, and returns its last error.
+func retryTransient(op func() error) error {
+	delay := transientDelay
+	for attempt := 0; ; attempt++ {
+		err := op()
+		if err == nil || attempt >= transientRetries || !isTransient(err) {
+			return err
+		}
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+// isTransient returns true if a socket error is temporary, e.g. EAGAIN or a timeout,
+// as opposed to a closed socket or connection.
+func isTransient(err error) bool {
+	if errors.Is(err, zmq4.ErrClosedConn) || errors.Is(err, net.ErrClosed) ||
+		errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	if errors.Is(err, syscall.EAGAIN) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+func (ch *channel) close() error {
+	ch.lock.Lock()
+	defer ch.lock.Unlock()
+	if ch.socket == nil {
+		return nil
+	}
+	return ch.socket.Close()
+}
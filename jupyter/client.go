@@ -3,10 +3,16 @@ package jupyter
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"hash"
 	"log"
+	"net"
 	"os"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/go-zeromq/zmq4"
@@ -27,11 +33,32 @@ type ConnectionInfo struct {
 }
 
 func (info *ConnectionInfo) ShellAddr() string {
-	return fmt.Sprintf("%s://%s:%d", info.Transport, info.IP, info.ShellPort)
+	return info.addr(info.ShellPort)
 }
 
 func (info *ConnectionInfo) IoPubAddr() string {
-	return fmt.Sprintf("%s://%s:%d", info.Transport, info.IP, info.IoPubPort)
+	return info.addr(info.IoPubPort)
+}
+
+func (info *ConnectionInfo) ControlAddr() string {
+	return info.addr(info.ControlPort)
+}
+
+func (info *ConnectionInfo) StdinAddr() string {
+	return info.addr(info.StdinPort)
+}
+
+func (info *ConnectionInfo) HeartBeatAddr() string {
+	return info.addr(info.HeartBeatPort)
+}
+
+// addr returns the ZeroMQ endpoint of the port, IPv6 hosts are bracketed, e.g. 'tcp://[::1]:5555'.
+func (info *ConnectionInfo) addr(port int) string {
+	if info.Transport == "ipc" {
+		// ipc endpoints are files named after the ip and port, as created by jupyter_client
+		return fmt.Sprintf("ipc://%s-%d", info.IP, port)
+	}
+	return fmt.Sprintf("%s://%s", info.Transport, net.JoinHostPort(info.IP, strconv.Itoa(port)))
 }
 
 func ReadConfigFile(path string) (info ConnectionInfo, err error) {
@@ -45,169 +72,961 @@ func ReadConfigFile(path string) (info ConnectionInfo, err error) {
 	return
 }
 
+// WriteFile writes the connection info to a connection file readable by kernels.
+func (info *ConnectionInfo) WriteFile(path string) error {
+	data, err := json.MarshalIndent(info, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0600)
+}
+
+func newUUID() string {
+	return uuid.New().String()
+}
+
+// signKey returns the key used to sign messages, messages are not signed if the key is empty.
+func signKey(key string) []byte {
+	if key == "" {
+		return nil
+	}
+	return []byte(key)
+}
+
+var (
+	// ErrClientClosed is returned when a request is made on a closed client.
+	ErrClientClosed = errors.New("Client is closed")
+
+	// ErrReconnected is returned by requests pending when the client reconnected.
+	ErrReconnected = errors.New("Client reconnected")
+
+	// ErrKernelRestarting is returned by requests made after the kernel was asked to restart,
+	// until the client reconnects.
+	ErrKernelRestarting = errors.New("Kernel is restarting, the client has to reconnect")
+
+	// ErrKernelShutdown is returned by requests made after the kernel was shut down.
+	ErrKernelShutdown = errors.New("Kernel is shut down")
+
+	// ErrOutputIncomplete is returned by executions waiting for idle status when their channel
+	// was closed before, e.g. by CancelAll or Reconnect.
+	ErrOutputIncomplete = errors.New("Execution output closed before idle status")
+)
+
 // Client - Jupyter kernel client.
 type Client struct {
-	shell   zmq4.Socket
-	iopub   zmq4.Socket
-	signKey []byte
-	session uuid.UUID
+	baseCtx  context.Context
+	ctx      context.Context
+	cancel   context.CancelFunc
+	info     ConnectionInfo
+	shell    *channel
+	iopub    *channel
+	session  string
+	username string
+	version  string
+
+	// identity of the shell socket, defaults to the session.
+	identity []byte
+
+	// newID generates message, session and comm identifiers, defaults to random UUIDs.
+	newID func() string
+
+	// now returns the time of message headers, defaults to time.Now.
+	now func() time.Time
+
+	// Control channel is used for priority requests, e.g. debugging.
+	control *channel
+
+	// Stdin channel receives input requests, it is only connected if the kernel has a stdin port.
+	stdin *channel
+
+	// Lock used to register input handlers of executions by msg_id.
+	inputLock     *sync.Mutex
+	inputHandlers map[string]InputHandler
+
+	// Lock used to connect, reconnect and close the client.
+	connLock *sync.Mutex
+
+	// Lock used to sign messages and replace the key when the connection file is reloaded.
+	keyLock  *sync.Mutex
+	signKey  []byte
+	signHash func() hash.Hash
+
+	// Connection file reloaded after reloadAfter consecutive messages with invalid signatures.
+	reloadPath        string
+	reloadAfter       int
+	invalidSignatures int
+
+	// sockets creates the kernel sockets, defaults to go-zeromq sockets.
+	sockets SocketFactory
+
+	// Lock used to add and delete pending replies.
+	// Replies are matched to requests by parent header msg_id.
+	replyLock *sync.Mutex
+	replies   map[string]chan pendingReply
+	replyErr  error
+
+	// Heartbeat socket is dialed on first ping, at the address of the last connection.
+	hbLock    *sync.Mutex
+	hbAddr    string
+	heartbeat zmq4.Socket
+
+	// Number of dial attempts and the initial delay between them, zero uses zmq4 retries.
+	connectAttempts int
+	connectDelay    time.Duration
+
+	// Timeout of a single dial attempt, zero uses the operating system default.
+	dialTimeout time.Duration
+
+	// Time to wait for control replies and heartbeat echoes, zero waits until the context is done.
+	recvTimeout time.Duration
+
+	// Time an execution may take until idle status, zero waits until the context is done.
+	executionTimeout time.Duration
+
+	// Kernel info reply cached by KernelInfo, requested on connect if kernelInfoOnConnect is set.
+	infoLock            *sync.Mutex
+	kernelInfo          *KernelInfoReply
+	kernelInfoOnConnect bool
+
+	// IOPub topic prefixes to subscribe to, defaults to all topics.
+	subscriptions []string
+
+	// sessionFilter drops IOPub messages of other sessions before parsing their content.
+	sessionFilter bool
+
+	// iopubHWM limits the number of IOPub messages waiting for delivery, zero doesn't queue messages.
+	iopubHWM int
+
+	// storeHistory enables history for non-silent executions.
+	storeHistory bool
+
+	// strict enables validation of headers of sent and received messages.
+	strict bool
+
+	// rawObserver is called with raw frames of sent and received messages.
+	rawObserver func(direction string, frames [][]byte)
+
+	// tracer starts a span for each request round-trip.
+	tracer Tracer
+
+	// Last message sent on the shell or control channel.
+	lastLock    *sync.Mutex
+	lastRequest Message
+
+	// Lock used to register comm targets and track open comms by id.
+	commLock    *sync.Mutex
+	commTargets map[string]commTarget
+	comms       map[string]string
+
+	// Highest execution count seen in replies and IOPub messages.
+	countLock      *sync.Mutex
+	executionCount int
 
 	// Lock used to add and delete channels.
 	ioChanLock *sync.RWMutex
-	ioChannels map[string]chan<- interface{}
+	ioChannels map[string]*ioChannel
+
+	// observer receives all IOPub messages, it is created by Observe.
+	observer *ioChannel
+
+	// closing is set when the client stops accepting new requests.
+	// It is guarded by ioChanLock.
+	closing bool
+
+	// ioChanged is closed when a channel is closed while CloseWait waits, guarded by ioChanLock.
+	ioChanged chan struct{}
+
+	// ioDone is closed when polling of the current connection returns.
+	ioDone chan struct{}
+
+	// Number of messages delivered from IOPub, only accessed by deliverIO.
+	ioSeq uint64
+
+	// Number of IOPub messages dropped while the delivery queue was full.
+	ioDropped *atomic.Uint64
+}
+
+func NewClient(ctx context.Context, info *ConnectionInfo, opts ...Option) (_ *Client, err error) {
+	client := Client{
+		baseCtx:       ctx,
+		info:          *info,
+		connLock:      new(sync.Mutex),
+		keyLock:       new(sync.Mutex),
+		sockets:       zmqSockets{},
+		replyLock:     new(sync.Mutex),
+		replies:       make(map[string]chan pendingReply),
+		hbLock:        new(sync.Mutex),
+		signKey:       signKey(info.Key),
+		newID:         newUUID,
+		now:           time.Now,
+		username:      "go-jupyter",
+		version:       Version,
+		countLock:     new(sync.Mutex),
+		lastLock:      new(sync.Mutex),
+		infoLock:      new(sync.Mutex),
+		commLock:      new(sync.Mutex),
+		inputLock:     new(sync.Mutex),
+		commTargets:   make(map[string]commTarget),
+		inputHandlers: make(map[string]InputHandler),
+		comms:         make(map[string]string),
+		ioChanLock:    new(sync.RWMutex),
+		ioChannels:    make(map[string]*ioChannel),
+		ioDropped:     new(atomic.Uint64),
+	}
+	for _, opt := range opts {
+		opt(&client)
+	}
+	if client.signHash, err = SignatureHash(info.SignatureScheme); err != nil {
+		return
+	}
+	if client.session == "" {
+		client.session = client.newID()
+	}
+	if client.identity == nil {
+		client.identity = []byte(client.session)
+	}
+	if client.subscriptions == nil {
+		client.subscriptions = []string{""}
+	}
+	client.shell = client.newChannel("shell")
+	client.control = client.newChannel("control")
+	client.iopub = client.newChannel("iopub")
+	client.stdin = client.newChannel("stdin")
+	if err = client.connect(); err != nil {
+		return
+	}
+	if err = client.requestKernelInfoOnConnect(); err != nil {
+		client.Close()
+		return
+	}
+	return &client, nil
 }
 
-func NewClient(ctx context.Context, info *ConnectionInfo) (_ *Client, err error) {
-	ctx, cancel := context.WithCancel(ctx)
+// connect creates and dials the kernel sockets and starts polling them.
+func (client *Client) connect() (err error) {
+	ctx, cancel := context.WithCancel(client.baseCtx)
 	defer func() {
 		if err != nil {
 			cancel()
 		}
 	}()
-	shell := zmq4.NewReq(ctx)
-	if err = shell.Dial(info.ShellAddr()); err != nil {
-		err = fmt.Errorf("Shell connection error: %v", err)
-		return
+	client.hbLock.Lock()
+	client.ctx = ctx
+	client.hbAddr = client.info.HeartBeatAddr()
+	client.hbLock.Unlock()
+
+	shell := client.sockets.NewDealer(ctx, append(client.socketOptions(), zmq4.WithID(client.identity))...)
+	client.shell.reset(shell)
+	if err = client.dial(shell, client.info.ShellAddr()); err != nil {
+		return fmt.Errorf("Shell connection error: %w", err)
 	}
-	iopub := zmq4.NewSub(ctx)
-	if err = iopub.Dial(info.IoPubAddr()); err != nil {
-		err = fmt.Errorf("IoPub connection error: %v", err)
-		return
+	control := client.sockets.NewDealer(ctx, client.socketOptions()...)
+	client.control.reset(control)
+	if err = client.dial(control, client.info.ControlAddr()); err != nil {
+		return fmt.Errorf("Control connection error: %w", err)
 	}
-	if err = iopub.SetOption(zmq4.OptionSubscribe, ""); err != nil {
-		return
+	client.stdin.reset(nil)
+	if client.info.StdinPort != 0 {
+		// the kernel sends input requests to the identity of the shell socket
+		stdin := client.sockets.NewDealer(ctx, append(client.socketOptions(), zmq4.WithID(client.identity))...)
+		client.stdin.reset(stdin)
+		if err = client.dial(stdin, client.info.StdinAddr()); err != nil {
+			return fmt.Errorf("Stdin connection error: %w", err)
+		}
 	}
-	client := Client{
-		shell:      shell,
-		iopub:      iopub,
-		signKey:    []byte(info.Key),
-		session:    uuid.New(),
-		ioChanLock: new(sync.RWMutex),
-		ioChannels: make(map[string]chan<- interface{}),
+	iopub := client.sockets.NewSub(ctx, client.socketOptions()...)
+	client.iopub.reset(iopub)
+	if err = client.dial(iopub, client.info.IoPubAddr()); err != nil {
+		return fmt.Errorf("IoPub connection error: %w", err)
 	}
-	go func() {
-		if err := client.pollIO(); err != nil {
-			cancel()
+	for _, prefix := range client.subscriptions {
+		if err = iopub.SetOption(zmq4.OptionSubscribe, prefix); err != nil {
+			return
 		}
+	}
+
+	client.cancel = cancel
+	done := make(chan struct{})
+	client.ioDone = done
+	polling := new(sync.WaitGroup)
+	polling.Add(3)
+	go func() {
+		defer polling.Done()
+		client.pollReplies(ctx, client.shell)
 	}()
-	return &client, nil
+	go func() {
+		defer polling.Done()
+		client.pollReplies(ctx, client.control)
+	}()
+	go func() {
+		defer polling.Done()
+		client.pollIO(ctx)
+	}()
+	if client.info.StdinPort != 0 {
+		polling.Add(1)
+		go func() {
+			defer polling.Done()
+			client.pollStdin(ctx)
+		}()
+	}
+	go func() {
+		polling.Wait()
+		close(done)
+	}()
+	return nil
+}
+
+func (client *Client) socketOptions() (opts []zmq4.Option) {
+	if client.connectAttempts > 0 {
+		// retries are done in dial
+		opts = append(opts, zmq4.WithDialerMaxRetries(0))
+	}
+	if client.dialTimeout > 0 {
+		opts = append(opts, zmq4.WithDialerTimeout(client.dialTimeout))
+	}
+	return
+}
+
+// dial connects the socket, retrying with exponential backoff if WithConnectRetry is used.
+func (client *Client) dial(socket zmq4.Socket, addr string) error {
+	delay := client.connectDelay
+	for attempt := 1; ; attempt++ {
+		err := socket.Dial(addr)
+		if err == nil || attempt >= client.connectAttempts {
+			return err
+		}
+		select {
+		case <-client.ctx.Done():
+			return client.ctx.Err()
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
 }
 
 func (client *Client) createHeader(msgType string) Header {
 	return Header{
-		Version:  Version,
-		Date:     time.Now().UTC().Format(time.RFC3339),
-		MsgID:    uuid.New().String(),
+		Version:  client.version,
+		Date:     client.now().UTC().Format(time.RFC3339),
+		MsgID:    client.newID(),
 		MsgType:  msgType,
-		Username: "go-jupyter",
-		Session:  client.session.String(),
+		Username: client.username,
+		Session:  client.session,
 	}
 }
 
-func (client *Client) createMessage(msgType string, req interface{}) Message {
-	return Message{
+func (client *Client) createMessage(msgType string, req interface{}, opts ...MessageOption) Message {
+	msg := Message{
 		Header:   client.createHeader(msgType),
 		Metadata: make(map[string]interface{}),
 		Content:  req,
 	}
+	for _, opt := range opts {
+		opt(&msg)
+	}
+	return msg
 }
 
-func (client *Client) Execute(req *ExecutionRequest) (rep ExecutionResult, ch <-chan interface{}, err error) {
-	msg := client.createMessage(RequestExecute, req)
-	ch = client.addIOChannel(msg.Header.MsgID)
-	err = client.request(msg, &rep)
+// Execute sends an execute request and returns the reply with a channel of IOPub messages
+// caused by the request. The channel is closed when the kernel reports idle status for the request.
+// Silent executions broadcast no output, the returned channel is already closed.
+//
+// Messages are delivered in the order they were published by the kernel: the first message is
+// a StatusMessage with StateBusy, followed by execute_input and outputs, and the last message
+// is a StatusMessage with StateIdle. Clients can show a progress indicator between the two.
+func (client *Client) Execute(req *ExecutionRequest, opts ...MessageOption) (rep ExecutionResult, ch <-chan interface{}, err error) {
+	return client.ExecuteContext(context.Background(), req, opts...)
+}
+
+// ExecuteContext sends an execute request like Execute, cancelling the context interrupts the execution.
+// If the context is done before the kernel replies, an interrupt_request is sent on the control channel
+// and the context error is returned. If it is done later, the returned channel is closed
+// without waiting for the kernel to report idle status.
+func (client *Client) ExecuteContext(ctx context.Context, req *ExecutionRequest, opts ...MessageOption) (rep ExecutionResult, ch <-chan interface{}, err error) {
+	ctx, cancel := client.withExecutionTimeout(ctx)
+	return client.executeResult(ctx, cancel, req, opts...)
+}
+
+// executeResult sends an execute request like ExecuteContext, cancel is called when the execution is done.
+func (client *Client) executeResult(ctx context.Context, cancel context.CancelFunc, req *ExecutionRequest, opts ...MessageOption) (rep ExecutionResult, ch <-chan interface{}, err error) {
+	if ch, err = client.executeContext(ctx, cancel, req, &rep, opts...); err != nil {
+		return
+	}
+	client.observeExecutionCount(rep.ExecutionCount)
 	return
 }
 
-func (client *Client) addIOChannel(id string) <-chan interface{} {
+// withExecutionTimeout returns a context done when the execution timeout elapses, see WithExecutionTimeout.
+func (client *Client) withExecutionTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if client.executionTimeout > 0 {
+		return context.WithTimeout(ctx, client.executionTimeout)
+	}
+	return ctx, func() {}
+}
+
+// executeContext sends an execute request and decodes the reply into rep, e.g. to read user expressions.
+// The channel of a request that failed is dropped, cancel is called when the execution is done.
+func (client *Client) executeContext(ctx context.Context, cancel context.CancelFunc, req *ExecutionRequest, rep interface{}, opts ...MessageOption) (ch <-chan interface{}, err error) {
+	msg := client.createMessage(RequestExecute, client.normalizeExecute(req), opts...)
+	id := msg.Header.MsgID
+	if ch, err = client.addIOChannel(id, req.Silent); err != nil {
+		cancel()
+		return
+	}
+	if req.OnInput != nil {
+		// input is requested before the kernel replies
+		client.setInputHandler(id, req.OnInput)
+		defer client.setInputHandler(id, nil)
+	}
+	var sent bool
+	if sent, err = client.roundTrip(ctx, client.shell, msg, rep); err != nil {
+		if !sent {
+			// the kernel never publishes output of the request
+			client.deleteIOChannel(id)
+			cancel()
+			return
+		}
+		if ctx.Err() != nil {
+			// the reply is dropped when it arrives, as the request is no longer pending
+			_ = client.control.send(client.createMessage(RequestInterrupt, struct{}{}))
+		}
+		client.discardIOChannel(id)
+		cancel()
+		return
+	}
+	if ioch, ok := client.getIOChannel(id); ok && ctx.Done() != nil {
+		go func() {
+			defer cancel()
+			select {
+			case <-ctx.Done():
+				client.discardIOChannel(id)
+			case <-ioch.done:
+			}
+		}()
+	} else {
+		cancel()
+	}
+	return
+}
+
+// Interrupt sends an interrupt_request on the control channel and waits for the reply.
+// Kernels with the 'message' interrupt mode stop the running execution, see KernelSpec.InterruptMode.
+func (client *Client) Interrupt() error {
+	var rep struct {
+		Status Status `json:"status"`
+	}
+	msg := client.createMessage(RequestInterrupt, struct{}{})
+	if err := client.controlRequest(context.Background(), msg, &rep); err != nil {
+		return err
+	}
+	if rep.Status != StatusOk {
+		return fmt.Errorf("Interrupt failed with status: %s", rep.Status)
+	}
+	return nil
+}
+
+// ConnectionInfo returns the connection info of the kernel the client is connected to.
+// The key is redacted, it is returned by SigningKey.
+func (client *Client) ConnectionInfo() ConnectionInfo {
+	client.connLock.Lock()
+	defer client.connLock.Unlock()
+	info := client.info
+	info.Key = ""
+	return info
+}
+
+// SigningKey returns the key used to sign messages, e.g. to connect a second client to the kernel.
+func (client *Client) SigningKey() string {
+	client.connLock.Lock()
+	defer client.connLock.Unlock()
+	return client.info.Key
+}
+
+// LastRequest returns the last message sent on the shell or control channel,
+// after defaults of the request were applied, e.g. to debug the content sent to the kernel.
+func (client *Client) LastRequest() Message {
+	client.lastLock.Lock()
+	defer client.lastLock.Unlock()
+	return client.lastRequest
+}
+
+func (client *Client) setLastRequest(msg Message) {
+	client.lastLock.Lock()
+	defer client.lastLock.Unlock()
+	client.lastRequest = msg
+}
+
+// LastExecutionCount returns the highest execution count seen in execute replies
+// and execute_input/execute_result messages, e.g. to number In[n]/Out[n] prompts.
+func (client *Client) LastExecutionCount() int {
+	client.countLock.Lock()
+	defer client.countLock.Unlock()
+	return client.executionCount
+}
+
+func (client *Client) observeExecutionCount(count int) {
+	client.countLock.Lock()
+	defer client.countLock.Unlock()
+	if count > client.executionCount {
+		client.executionCount = count
+	}
+}
+
+// normalizeExecute returns a copy of the request following the protocol defaults.
+// Silent executions never store history.
+func (client *Client) normalizeExecute(req *ExecutionRequest) *ExecutionRequest {
+	normalized := *req
+	if normalized.UserExpressions == nil {
+		// some kernels reject `"user_expressions": null`
+		normalized.UserExpressions = map[string]string{}
+	}
+	if normalized.OnInput != nil {
+		normalized.AllowStdin = true
+	}
+	if normalized.Silent {
+		normalized.StoreHistory = false
+	} else if client.storeHistory {
+		normalized.StoreHistory = true
+	}
+	return &normalized
+}
+
+// addIOChannel registers a channel for IOPub messages caused by the request.
+// Messages of a discarded channel are dropped and a closed channel is returned.
+func (client *Client) addIOChannel(id string, discard bool) (<-chan interface{}, error) {
 	client.ioChanLock.Lock()
 	defer client.ioChanLock.Unlock()
-	ch := make(chan interface{})
+	if client.closing {
+		return nil, ErrClientClosed
+	}
+	// fail before registering a channel the kernel will never publish to
+	if err := client.pendingReplyErr(); err != nil {
+		return nil, err
+	}
+	ch := newIOChannel()
 	client.ioChannels[id] = ch
-	return ch
+	if discard {
+		ch.discard()
+	}
+	return ch.ch, nil
 }
 
-func (client *Client) Inspect(req *IntrospectionRequest) (rep InspectReply, err error) {
-	msg := client.createMessage(RequestInspect, req)
-	err = client.request(msg, &rep)
+func (client *Client) Inspect(req *IntrospectionRequest, opts ...MessageOption) (rep InspectReply, err error) {
+	return client.InspectContext(context.Background(), req, opts...)
+}
+
+// InspectContext sends an inspect request and waits for the reply until the context is done.
+// A request issued while the kernel is busy executing a cell is only answered after the cell finishes.
+func (client *Client) InspectContext(ctx context.Context, req *IntrospectionRequest, opts ...MessageOption) (rep InspectReply, err error) {
+	msg := client.createMessage(RequestInspect, req, opts...)
+	err = client.requestContext(ctx, msg, &rep)
 	return
 }
 
-func (client *Client) History(req *HistoryRequest) (rep HistoryReply, err error) {
-	msg := client.createMessage(RequestHistory, req)
+// InspectAt inspects the code at the given cursor position.
+func (client *Client) InspectAt(code string, cursorPos, detailLevel int) (InspectReply, error) {
+	return client.Inspect(&IntrospectionRequest{
+		Code:        code,
+		CursorPos:   cursorPos,
+		DetailLevel: detailLevel,
+	})
+}
+
+// InspectSource inspects the code at the given cursor position with DetailLevelSource,
+// which includes the source code of the object if available.
+func (client *Client) InspectSource(code string, cursorPos int) (InspectReply, error) {
+	return client.InspectAt(code, cursorPos, DetailLevelSource)
+}
+
+// History requests the history of code executed in the kernel.
+// A reply of a kernel failing to access the history, e.g. for an invalid access type, has an error, see HistoryReply.Err.
+func (client *Client) History(req *HistoryRequest, opts ...MessageOption) (rep HistoryReply, err error) {
+	msg := client.createMessage(RequestHistory, req, opts...)
 	err = client.request(msg, &rep)
 	return
 }
 
-func (client *Client) request(req Message, rep interface{}) (err error) {
-	if err = client.sendRequest(req); err != nil {
+// SearchHistory returns up to n last raw input cells matching the glob pattern (with * and ? as wildcards).
+func (client *Client) SearchHistory(pattern string, n int, unique bool) ([]HistoryItem, error) {
+	rep, err := client.History(&HistoryRequest{
+		Raw:            true,
+		HistAccessType: "search",
+		Pattern:        pattern,
+		N:              n,
+		Unique:         unique,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return rep.History, rep.Err()
+}
+
+// TailHistory returns the last n raw input cells.
+func (client *Client) TailHistory(n int) ([]HistoryItem, error) {
+	rep, err := client.History(&HistoryRequest{
+		Raw:            true,
+		HistAccessType: "tail",
+		N:              n,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return rep.History, rep.Err()
+}
+
+// KernelInfo requests information about the kernel, e.g. its language and protocol version.
+// The reply is cached, later calls without options return it until the client reconnects.
+// Use WithKernelInfoOnConnect to request it when connecting.
+func (client *Client) KernelInfo(opts ...MessageOption) (rep KernelInfoReply, err error) {
+	if len(opts) == 0 {
+		if info := client.cachedKernelInfo(); info != nil {
+			return *info, nil
+		}
+	}
+	// The lock isn't held during the request, errors describe the kernel using the cache.
+	msg := client.createMessage(RequestKernelInfo, struct{}{}, opts...)
+	if err = client.request(msg, &rep); err != nil {
 		return
 	}
-	err = client.recvReply(&rep)
+	client.infoLock.Lock()
+	defer client.infoLock.Unlock()
+	client.kernelInfo = &rep
 	return
 }
 
-func (client *Client) sendRequest(msg Message) error {
-	frames := [][]byte{[]byte("<IDS|MSG>")}
-	encoded, err := msg.Encode(client.signKey)
+func (client *Client) cachedKernelInfo() *KernelInfoReply {
+	client.infoLock.Lock()
+	defer client.infoLock.Unlock()
+	return client.kernelInfo
+}
+
+// Banner returns the banner of the kernel, e.g. to greet users of a console frontend.
+// Kernel info is requested unless it is cached, see KernelInfo.
+// If the kernel has no banner, its implementation and version are returned.
+func (client *Client) Banner() (string, error) {
+	info, err := client.KernelInfo()
 	if err != nil {
-		return fmt.Errorf("Error encoding message: %v", err)
+		return "", err
+	}
+	if info.Banner != "" {
+		return info.Banner, nil
 	}
-	frames = append(frames, encoded...)
+	return strings.TrimSpace(info.Implementation + " " + info.ImplementationVersion), nil
+}
 
-	if err := client.shell.SendMulti(zmq4.NewMsgFrom(frames...)); err != nil {
-		return fmt.Errorf("Error sending shell message: %v", err)
+// kernelDescription returns the implementation of the kernel if kernel info is cached, e.g. for error messages.
+func (client *Client) kernelDescription() string {
+	client.infoLock.Lock()
+	defer client.infoLock.Unlock()
+	if client.kernelInfo == nil {
+		return "unknown kernel"
 	}
-	return nil
+	return strings.TrimSpace(client.kernelInfo.Implementation + " " + client.kernelInfo.ImplementationVersion)
+}
+
+func (client *Client) resetKernelInfo() {
+	client.infoLock.Lock()
+	defer client.infoLock.Unlock()
+	client.kernelInfo = nil
 }
 
-func (client *Client) recvReply(content interface{}) (err error) {
-	reply := Message{Content: content}
-	body, err := client.shell.Recv()
+// IsComplete asks the kernel whether the code is ready to be executed.
+func (client *Client) IsComplete(req *IsCompleteRequest, opts ...MessageOption) (rep IsCompleteReply, err error) {
+	msg := client.createMessage(RequestIsComplete, req, opts...)
+	err = client.request(msg, &rep)
+	return
+}
+
+// Connect asks the kernel for the ports it is listening on.
+func (client *Client) Connect(opts ...MessageOption) (rep ConnectReply, err error) {
+	msg := client.createMessage(RequestConnect, struct{}{}, opts...)
+	err = client.request(msg, &rep)
+	return
+}
+
+// Shutdown asks the kernel to shut down, or to restart if restart is true, and returns its reply.
+// Once the kernel replied with status 'ok', requests fail with ErrKernelRestarting
+// until the client reconnects to the restarted kernel with Reconnect,
+// or with ErrKernelShutdown if the kernel is not restarting.
+func (client *Client) Shutdown(restart bool, opts ...MessageOption) (rep ShutdownReply, err error) {
+	msg := client.createMessage(RequestShutdown, map[string]interface{}{"restart": restart}, opts...)
+	if err = client.controlRequest(context.Background(), msg, &rep); err != nil {
+		return
+	}
+	if rep.Status != StatusOk {
+		return rep, fmt.Errorf("Shutdown failed with status: %s", rep.Status)
+	}
+	if rep.Restart {
+		client.failPendingReplies(ErrKernelRestarting)
+	} else {
+		client.failPendingReplies(ErrKernelShutdown)
+	}
+	return
+}
+
+// Debug sends a debug_request wrapping a Debug Adapter Protocol request on the control channel
+// and returns the content of the debug_reply. Debug events are published as DebugEventMessage.
+// https://jupyter-client.readthedocs.io/en/latest/messaging.html#debug-request
+func (client *Client) Debug(content map[string]interface{}, opts ...MessageOption) (rep map[string]interface{}, err error) {
+	msg := client.createMessage(RequestDebug, content, opts...)
+	err = client.controlRequest(context.Background(), msg, &rep)
+	return
+}
+
+// Request sends a message of any type on the shell channel and decodes the content of its reply into reply,
+// e.g. to use message types of kernel extensions or of newer protocol versions.
+// The reply is expected to be of the request type with the '_request' suffix replaced by '_reply'.
+// The reply content is discarded if reply is nil.
+func (client *Client) Request(msgType string, content interface{}, reply interface{}, opts ...MessageOption) error {
+	if reply == nil {
+		reply = new(json.RawMessage)
+	}
+	msg := client.createMessage(msgType, content, opts...)
+	return client.request(msg, reply)
+}
+
+func (client *Client) request(req Message, rep interface{}) error {
+	return client.requestContext(context.Background(), req, rep)
+}
+
+// requestContext sends a shell request and waits for the reply until the context is done.
+func (client *Client) requestContext(ctx context.Context, req Message, rep interface{}) error {
+	return client.requestOn(ctx, client.shell, req, rep)
+}
+
+// controlRequest sends a control request and waits for the reply until the context is done
+// or the receive timeout passes.
+func (client *Client) controlRequest(ctx context.Context, req Message, rep interface{}) error {
+	if client.recvTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, client.recvTimeout)
+		defer cancel()
+	}
+	return client.requestOn(ctx, client.control, req, rep)
+}
+
+// requestOn sends a request on the channel and waits for the reply until the context is done.
+// Requests can be issued concurrently, replies are matched by parent header msg_id.
+func (client *Client) requestOn(ctx context.Context, ch *channel, req Message, rep interface{}) error {
+	_, err := client.roundTrip(ctx, ch, req, rep)
+	return err
+}
+
+// roundTrip is like requestOn, but it also reports whether the request was sent to the kernel.
+func (client *Client) roundTrip(ctx context.Context, ch *channel, req Message, rep interface{}) (sent bool, err error) {
+	if client.tracer != nil {
+		end := client.tracer.StartRequest(ctx, ch.name, req.Header.MsgType, req.Header.MsgID)
+		defer func() { end(err) }()
+	}
+	if client.isClosing() {
+		return false, ErrClientClosed
+	}
+	wait, err := client.addPendingReply(req.Header.MsgID)
 	if err != nil {
 		return
 	}
-	return reply.Decode(body.Frames, client.signKey)
+	defer client.deletePendingReply(req.Header.MsgID)
+	if err = ch.send(req); err != nil {
+		return
+	}
+	select {
+	case <-ctx.Done():
+		return true, ctx.Err()
+	case reply := <-wait:
+		if reply.err != nil {
+			return true, reply.err
+		}
+		// replies are routed by parent msg_id, a mismatched type indicates a misbehaving kernel or proxy
+		expected := strings.TrimSuffix(req.Header.MsgType, "_request") + "_reply"
+		if reply.msg.Header.MsgType != expected {
+			return true, fmt.Errorf("Unexpected reply to %s from %s: expected %s, got %s", req.Header.MsgType, client.kernelDescription(), expected, reply.msg.Header.MsgType)
+		}
+		if len(reply.msg.Content) == 0 {
+			return true, nil
+		}
+		return true, json.Unmarshal(reply.msg.Content, rep)
+	}
+}
+
+// observe passes raw frames to the observer set with WithRawObserver.
+func (client *Client) observe(direction string, frames [][]byte) {
+	if client.rawObserver != nil {
+		client.rawObserver(direction, frames)
+	}
 }
 
-func (client *Client) pollIO() (err error) {
+// pendingReply is a reply received on the shell or control channel.
+type pendingReply struct {
+	msg RawMessage
+	err error
+}
+
+func (client *Client) addPendingReply(id string) (<-chan pendingReply, error) {
+	client.replyLock.Lock()
+	defer client.replyLock.Unlock()
+	if client.replyErr != nil {
+		return nil, client.replyErr
+	}
+	ch := make(chan pendingReply, 1)
+	client.replies[id] = ch
+	return ch, nil
+}
+
+// pendingReplyErr returns the error failing new requests, e.g. ErrKernelRestarting.
+func (client *Client) pendingReplyErr() error {
+	client.replyLock.Lock()
+	defer client.replyLock.Unlock()
+	return client.replyErr
+}
+
+func (client *Client) deletePendingReply(id string) {
+	client.replyLock.Lock()
+	defer client.replyLock.Unlock()
+	delete(client.replies, id)
+}
+
+func (client *Client) pollReplies(ctx context.Context, ch *channel) {
 	for {
-		body, err := client.iopub.Recv()
+		var reply pendingReply
+		frames, err := ch.recv(&reply.msg)
+		if frames == nil {
+			if ctx.Err() != nil {
+				err = ErrClientClosed
+			} else {
+				err = fmt.Errorf("Error receiving %s message: %w", ch.name, err)
+			}
+			client.failPendingReplies(err)
+			return
+		}
 		if err != nil {
-			break
+			reply.err = err
+			// deliver the error to the request it answers, if it can be told
+			reply.msg.ParentHeader.MsgID = peekParentMsgID(frames)
 		}
-		var msg RawMessage
-		if err = msg.Decode(body.Frames, client.signKey); err != nil {
-			return fmt.Errorf("Error decoding a message: %#v", err)
+		client.replyLock.Lock()
+		if ch, ok := client.replies[reply.msg.ParentHeader.MsgID]; ok {
+			ch <- reply
+			delete(client.replies, reply.msg.ParentHeader.MsgID)
 		}
-		content, err := parseContent(msg.Header.MsgType, msg.Content)
-		if err != nil {
-			return fmt.Errorf("Error decoding a content: %#v (MsgType: %s)", err, msg.Header.MsgType)
+		client.replyLock.Unlock()
+	}
+}
+
+// peekParentMsgID returns the parent msg_id of a message that failed to decode.
+func peekParentMsgID(parts [][]byte) string {
+	index, err := findIndex(parts, "<IDS|MSG>")
+	if err != nil || len(parts) <= index+3 {
+		return ""
+	}
+	var parent Header
+	_ = json.Unmarshal(parts[index+3], &parent)
+	return parent.MsgID
+}
+
+// failPendingReplies delivers the error to all pending requests and fails the following ones
+// with the first error, until the client reconnects.
+func (client *Client) failPendingReplies(err error) {
+	client.replyLock.Lock()
+	defer client.replyLock.Unlock()
+	if client.replyErr == nil {
+		client.replyErr = err
+	}
+	for id, ch := range client.replies {
+		ch <- pendingReply{err: err}
+		delete(client.replies, id)
+	}
+}
+
+// pollIO delivers IOPub messages until the socket is closed.
+// With WithIOPubHWM, messages are queued for delivery and dropped while the queue is full.
+func (client *Client) pollIO(ctx context.Context) {
+	if client.iopubHWM <= 0 {
+		client.receiveIO(client.deliverIO)
+		return
+	}
+	queue := make(chan *RawMessage, client.iopubHWM)
+	delivered := make(chan struct{})
+	go func() {
+		defer close(delivered)
+		for msg := range queue {
+			// messages queued when disconnecting are dropped
+			if ctx.Err() == nil {
+				client.deliverIO(msg)
+			}
 		}
-		if ch, ok := client.getIOChannel(msg.ParentHeader.MsgID); ok {
-			ch <- content
-		} else if msgType := msg.ParentHeader.MsgType; maybeShouldListen(msgType) {
-			return fmt.Errorf("Message dropped on empty channel: %s", msgType)
+	}()
+	client.receiveIO(func(msg *RawMessage) {
+		select {
+		case queue <- msg:
+		default:
+			client.ioDropped.Add(1)
 		}
+	})
+	close(queue)
+	<-delivered
+}
+
+// DroppedIOPubMessages returns the number of IOPub messages dropped as the queue limited by WithIOPubHWM was full.
+func (client *Client) DroppedIOPubMessages() uint64 {
+	return client.ioDropped.Load()
+}
 
-		// close the channel if status is idle
-		if status, ok := content.(*StatusMessage); ok && status.ExecutionState == StateIdle {
-			client.deleteIOChannel(msg.ParentHeader.MsgID)
+// receiveIO passes received IOPub messages to deliver until the socket is closed.
+// Messages failing to decode are dropped, so a malformed message doesn't stop the client.
+func (client *Client) receiveIO(deliver func(*RawMessage)) {
+	for {
+		var msg RawMessage
+		frames, err := client.iopub.recv(&msg)
+		if frames == nil {
+			return
+		}
+		if err != nil {
+			// repeated invalid signatures reload the connection file, if enabled
+			log.Printf("Dropped IOPub message: %v", err)
+			continue
+		}
+		if client.sessionFilter && msg.ParentHeader.Session != client.session {
+			continue
 		}
+		deliver(&msg)
 	}
-	return
 }
 
-func maybeShouldListen(msgType string) bool {
-	switch msgType {
-	case RequestExecute:
-		return true
-	default:
-		return false
+// deliverIO delivers the message to the channel of its request and to the observer.
+func (client *Client) deliverIO(msg *RawMessage) {
+	content, err := parseContent(msg)
+	if err != nil {
+		log.Printf("Error decoding a content: %v (MsgType: %s)", err, msg.Header.MsgType)
+		return
+	}
+	client.ioSeq++
+	if envelope, ok := content.(interface{ setArrivalSeq(uint64) }); ok {
+		envelope.setArrivalSeq(client.ioSeq)
+	}
+	switch content := content.(type) {
+	case *ExecuteInputMessage:
+		client.observeExecutionCount(content.ExecutionCount)
+	case *ExecuteResultMessage:
+		client.observeExecutionCount(content.ExecutionCount)
+	case *CommOpenMessage, *CommMsgMessage, *CommCloseMessage:
+		client.handleComm(content)
+	}
+	// messages of requests of other clients, or published after idle, are only observed
+	if ch, ok := client.getIOChannel(msg.ParentHeader.MsgID); ok {
+		// the channel may be closed concurrently by Close
+		_ = ch.send(content)
+	}
+	if observer := client.getObserver(); observer != nil {
+		_ = observer.send(content)
+	}
+
+	// close the channel if status is idle
+	if status, ok := content.(*StatusMessage); ok && status.ExecutionState == StateIdle {
+		client.deleteIOChannel(msg.ParentHeader.MsgID)
 	}
 }
 
-func (client *Client) getIOChannel(id string) (ch chan<- interface{}, ok bool) {
+func (client *Client) getIOChannel(id string) (ch *ioChannel, ok bool) {
 	client.ioChanLock.RLock()
 	defer client.ioChanLock.RUnlock()
 	ch, ok = client.ioChannels[id]
@@ -218,28 +1037,288 @@ func (client *Client) deleteIOChannel(id string) {
 	client.ioChanLock.Lock()
 	defer client.ioChanLock.Unlock()
 	if ch, ok := client.ioChannels[id]; ok {
-		close(ch)
+		ch.close()
 	}
 	delete(client.ioChannels, id)
+	client.notifyIOChannels()
 }
 
-func (client *Client) Close() error {
-	defer func() {
-		client.ioChanLock.Lock()
-		defer client.ioChanLock.Unlock()
+// Observe returns a channel receiving all IOPub messages published by the kernel, regardless of the request
+// they were published for, e.g. to monitor executions of all clients of a shared kernel.
+// Messages of requests of this client are delivered to their channels first, sharing the same values.
+// Each call returns the same channel, it has to be received from, as IOPub polling waits until
+// the message is received. The channel is closed when the client is closed.
+func (client *Client) Observe() <-chan interface{} {
+	client.ioChanLock.Lock()
+	defer client.ioChanLock.Unlock()
+	if client.observer == nil {
+		client.observer = newIOChannel()
+		if client.closing {
+			client.observer.close()
+		}
+	}
+	return client.observer.ch
+}
 
-		if n := len(client.ioChannels); n != 0 {
-			log.Printf("Closing %d IO channels", n)
+func (client *Client) getObserver() *ioChannel {
+	client.ioChanLock.RLock()
+	defer client.ioChanLock.RUnlock()
+	return client.observer
+}
+
+// PendingExecutions returns msg_ids of executions with open channels of IOPub messages,
+// i.e. executions that did not report idle status yet.
+func (client *Client) PendingExecutions() []string {
+	client.ioChanLock.RLock()
+	defer client.ioChanLock.RUnlock()
+	ids := make([]string, 0, len(client.ioChannels))
+	for id, ch := range client.ioChannels {
+		if !ch.isClosed() {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// CancelAll interrupts the kernel if there are pending executions and closes their channels
+// without the final idle StatusMessage, dropping their following messages.
+// Executions waiting for a reply return when the kernel replies to the interrupted execution.
+func (client *Client) CancelAll() error {
+	ids := client.PendingExecutions()
+	if len(ids) == 0 {
+		return nil
+	}
+	err := client.Interrupt()
+	for _, id := range ids {
+		client.discardIOChannel(id)
+	}
+	return err
+}
+
+// discardIOChannel closes the channel of the request, dropping following messages until idle status.
+func (client *Client) discardIOChannel(id string) {
+	client.ioChanLock.Lock()
+	defer client.ioChanLock.Unlock()
+	if ch, ok := client.ioChannels[id]; ok {
+		ch.discard()
+		client.notifyIOChannels()
+	}
+}
+
+func (client *Client) isClosing() bool {
+	client.ioChanLock.RLock()
+	defer client.ioChanLock.RUnlock()
+	return client.closing
+}
+
+// pendingIOChannels returns the number of channels that are not closed, discarded channels
+// only wait for messages to drop. If there are any, the returned channel is closed when one of them is.
+func (client *Client) pendingIOChannels() (n int, changed <-chan struct{}) {
+	client.ioChanLock.Lock()
+	defer client.ioChanLock.Unlock()
+	for _, ch := range client.ioChannels {
+		if !ch.isClosed() {
+			n++
 		}
-		for _, ch := range client.ioChannels {
-			close(ch)
+	}
+	if n == 0 {
+		return
+	}
+	if client.ioChanged == nil {
+		client.ioChanged = make(chan struct{})
+	}
+	return n, client.ioChanged
+}
+
+// notifyIOChannels wakes up callers waiting for pending channels, the lock has to be held.
+func (client *Client) notifyIOChannels() {
+	if client.ioChanged != nil {
+		close(client.ioChanged)
+		client.ioChanged = nil
+	}
+}
+
+// CloseWait stops accepting new requests and waits up to the timeout
+// for pending executions to reach idle state before closing the client.
+func (client *Client) CloseWait(timeout time.Duration) error {
+	client.ioChanLock.Lock()
+	client.closing = true
+	client.ioChanLock.Unlock()
+
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	for n, changed := client.pendingIOChannels(); n != 0; n, changed = client.pendingIOChannels() {
+		select {
+		case <-changed:
+		case <-deadline.C:
+			return client.Close()
 		}
-	}()
+	}
+	return client.Close()
+}
+
+// Close cancels the client context, stopping the IOPub polling, closes all IO channels and sockets.
+func (client *Client) Close() error {
+	client.ioChanLock.Lock()
+	client.closing = true
+	client.ioChanLock.Unlock()
+
+	client.connLock.Lock()
+	defer client.connLock.Unlock()
+	return client.disconnect(false)
+}
+
+// Reconnect closes the kernel sockets and dials them again, e.g. after the kernel was restarted
+// or its connection was lost. Requests waiting for a reply fail with ErrReconnected.
+// Requests made after a successful reconnect no longer fail with ErrKernelRestarting.
+// IO channels of executions in flight are closed without the final idle StatusMessage
+// and their messages published later are dropped; callers can tell an execution
+// was abandoned by the missing idle status.
+func (client *Client) Reconnect() error {
+	client.connLock.Lock()
+	defer client.connLock.Unlock()
+	return client.reconnect()
+}
+
+// reconnect closes and dials the kernel sockets, connLock has to be held.
+func (client *Client) reconnect() error {
+	if client.isClosing() {
+		return ErrClientClosed
+	}
+	client.failPendingReplies(ErrReconnected)
+	client.disconnect(true)
+	if err := client.connect(); err != nil {
+		client.replyLock.Lock()
+		client.replyErr = err
+		client.replyLock.Unlock()
+		return err
+	}
+	client.replyLock.Lock()
+	client.replyErr = nil
+	client.replyLock.Unlock()
+	client.resetKernelInfo()
+	return client.requestKernelInfoOnConnect()
+}
+
+// signing returns the key and the hash function used to sign messages.
+func (client *Client) signing() ([]byte, func() hash.Hash) {
+	client.keyLock.Lock()
+	defer client.keyLock.Unlock()
+	return client.signKey, client.signHash
+}
+
+// observeSignature counts consecutive messages with invalid signatures and reloads the connection file
+// once the limit set with WithConnectionFileReload is reached. Any other result of decoding resets the count.
+func (client *Client) observeSignature(err error) {
+	if client.reloadPath == "" {
+		return
+	}
+	client.keyLock.Lock()
+	defer client.keyLock.Unlock()
+	if !errors.Is(err, ErrInvalidSignature) {
+		client.invalidSignatures = 0
+		return
+	}
+	client.invalidSignatures++
+	if client.invalidSignatures == client.reloadAfter {
+		// reconnecting waits for polling to return, so it can't be done by the poller
+		go func() {
+			if err := client.reloadConnectionFile(); err != nil && err != ErrClientClosed {
+				log.Printf("Error reloading connection file %s: %v", client.reloadPath, err)
+			}
+		}()
+	}
+}
+
+// reloadConnectionFile reads the connection file, replaces the signing key and reconnects to the kernel.
+func (client *Client) reloadConnectionFile() error {
+	info, err := ReadConfigFile(client.reloadPath)
+	var hash func() hash.Hash
+	if err == nil {
+		hash, err = SignatureHash(info.SignatureScheme)
+	}
+	if err != nil {
+		// count invalid signatures again to retry the reload
+		client.keyLock.Lock()
+		client.invalidSignatures = 0
+		client.keyLock.Unlock()
+		return err
+	}
+	client.connLock.Lock()
+	defer client.connLock.Unlock()
+	if client.isClosing() {
+		return ErrClientClosed
+	}
+	client.info = info
+	client.keyLock.Lock()
+	client.signKey = signKey(info.Key)
+	client.signHash = hash
+	client.invalidSignatures = 0
+	client.keyLock.Unlock()
+	return client.reconnect()
+}
 
-	err1 := client.shell.Close()
-	err2 := client.iopub.Close()
+func (client *Client) requestKernelInfoOnConnect() error {
+	if !client.kernelInfoOnConnect {
+		return nil
+	}
+	if _, err := client.KernelInfo(); err != nil {
+		return fmt.Errorf("Kernel info error: %w", err)
+	}
+	return nil
+}
+
+// disconnect stops polling, closes all IO channels and sockets.
+// Discarded IO channels are removed, a restarted kernel never reports their idle status
+// and messages of abandoned executions are dropped as messages without a channel.
+func (client *Client) disconnect(discard bool) error {
+	client.cancel()
+	if discard {
+		client.discardIOChannels()
+	} else {
+		client.closeIOChannels()
+	}
+	<-client.ioDone
+
+	client.hbLock.Lock()
+	if client.heartbeat != nil {
+		client.heartbeat.Close()
+		client.heartbeat = nil
+	}
+	client.hbLock.Unlock()
+
+	err1 := client.shell.close()
+	err2 := client.iopub.close()
+	client.control.close()
+	client.stdin.close()
 	if err1 != nil {
 		return err1
 	}
 	return err2
 }
+
+func (client *Client) discardIOChannels() {
+	client.ioChanLock.Lock()
+	defer client.ioChanLock.Unlock()
+	for id, ch := range client.ioChannels {
+		ch.discard()
+		delete(client.ioChannels, id)
+	}
+	client.notifyIOChannels()
+}
+
+func (client *Client) closeIOChannels() {
+	client.ioChanLock.Lock()
+	defer client.ioChanLock.Unlock()
+
+	if n := len(client.ioChannels); n != 0 {
+		log.Printf("Closing %d IO channels", n)
+	}
+	for id, ch := range client.ioChannels {
+		ch.close()
+		delete(client.ioChannels, id)
+	}
+	if client.observer != nil {
+		client.observer.close()
+	}
+}
@@ -0,0 +1,576 @@
+package jupyter_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-zeromq/zmq4"
+
+	"github.com/crackcomm/go-jupyter/jupyter"
+	"github.com/crackcomm/go-jupyter/jupyter/jupytertest"
+)
+
+// newTestClient starts a fake kernel and connects a client to it, both are closed when the test ends.
+func newTestClient(t testing.TB, opts ...jupyter.Option) (*jupytertest.FakeKernel, *jupyter.Client) {
+	t.Helper()
+	kernel, err := jupytertest.NewFakeKernel(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { kernel.Close() })
+	info := kernel.ConnectionInfo()
+	client, err := jupyter.NewClient(context.Background(), &info, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return kernel, client
+}
+
+func TestCloseWithBlockedReceivers(t *testing.T) {
+	for i := 0; i < 20; i++ {
+		_, client := newTestClient(t)
+		executions := new(sync.WaitGroup)
+		for j := 0; j < 6; j++ {
+			executions.Add(1)
+			go func(j int) {
+				defer executions.Done()
+				_, ch, err := client.Execute(&jupyter.ExecutionRequest{Code: "print(1)"})
+				if err != nil || j%2 == 1 {
+					// the channel of an odd execution is never received from
+					return
+				}
+				go func() {
+					for range ch {
+					}
+				}()
+			}(j)
+		}
+		stop := make(chan struct{})
+		polling := new(sync.WaitGroup)
+		polling.Add(1)
+		go func() {
+			defer polling.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+					client.PendingExecutions()
+				}
+			}
+		}()
+		executions.Wait()
+		time.Sleep(time.Duration(i%4) * time.Millisecond)
+
+		closed := make(chan struct{})
+		go func() {
+			client.Close()
+			close(closed)
+		}()
+		select {
+		case <-closed:
+		case <-time.After(5 * time.Second):
+			t.Fatal("Close did not return")
+		}
+		close(stop)
+		polling.Wait()
+	}
+}
+
+// waitForIOPub executes code until the client receives its IOPub messages,
+// as a subscription to the kernel is only established some time after connecting.
+func waitForIOPub(t testing.TB, client *jupyter.Client) {
+	t.Helper()
+	for i := 0; i < 50; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		_, ch, err := client.ExecuteContext(ctx, &jupyter.ExecutionRequest{Code: "pass"})
+		if err != nil {
+			cancel()
+			t.Fatal(err)
+		}
+		received := false
+		for range ch {
+			received = true
+		}
+		cancel()
+		if received {
+			return
+		}
+	}
+	t.Fatal("no IOPub messages received")
+}
+
+func TestForeignOutputDropped(t *testing.T) {
+	kernel, client := newTestClient(t)
+	info := kernel.ConnectionInfo()
+	other, err := jupyter.NewClient(context.Background(), &info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer other.Close()
+	waitForIOPub(t, client)
+	waitForIOPub(t, other)
+
+	// output of executions of the other client is published to both clients
+	if _, err := other.ExecuteAndWait(&jupyter.ExecutionRequest{Code: "print(1)"}); err != nil {
+		t.Fatal(err)
+	}
+	_, ch, err := client.Execute(&jupyter.ExecutionRequest{Code: "print(2)"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var inputs []string
+	for msg := range ch {
+		if input, ok := msg.(*jupyter.ExecuteInputMessage); ok {
+			inputs = append(inputs, input.Code)
+		}
+	}
+	if len(inputs) != 1 || inputs[0] != "print(2)" {
+		t.Fatalf("unexpected execute_input messages %q", inputs)
+	}
+}
+
+func TestMalformedOutputDropped(t *testing.T) {
+	kernel, client := newTestClient(t)
+	kernel.Handle(jupyter.RequestExecute, func(req *jupyter.RawMessage) jupytertest.Reply {
+		return jupytertest.Reply{
+			Content: jupyter.ExecutionResult{Status: jupyter.StatusOk},
+			IOPub: []jupytertest.Output{
+				{MsgType: "stream", Content: "not an object"},
+				{MsgType: "stream", Content: jupyter.StreamMessage{Name: "stdout", Text: "ok"}},
+			},
+		}
+	})
+	for i := 0; i < 2; i++ {
+		_, ch, err := client.Execute(&jupyter.ExecutionRequest{Code: "print('ok')"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var streams []string
+		for msg := range ch {
+			if stream, ok := msg.(*jupyter.StreamMessage); ok {
+				streams = append(streams, stream.Text)
+			}
+		}
+		if len(streams) != 1 || streams[0] != "ok" {
+			t.Fatalf("unexpected streams %q", streams)
+		}
+	}
+}
+
+func TestIOPubHWM(t *testing.T) {
+	kernel, client := newTestClient(t, jupyter.WithIOPubHWM(1))
+	kernel.Handle(jupyter.RequestExecute, func(req *jupyter.RawMessage) jupytertest.Reply {
+		reply := jupytertest.Reply{Content: jupyter.ExecutionResult{Status: jupyter.StatusOk}}
+		for i := 0; i < 10; i++ {
+			reply.IOPub = append(reply.IOPub, jupytertest.Output{
+				MsgType: "stream",
+				Content: jupyter.StreamMessage{Name: "stdout", Text: "line\n"},
+			})
+		}
+		return reply
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	_, ch, err := client.ExecuteContext(ctx, &jupyter.ExecutionRequest{Code: "print('line')"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the channel isn't received from, so the queue fills up
+	for client.DroppedIOPubMessages() == 0 {
+		if ctx.Err() != nil {
+			t.Fatal("no IOPub messages dropped")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	for range ch {
+	}
+}
+
+func TestCloseWaitSkipsDiscardedExecutions(t *testing.T) {
+	kernel, client := newTestClient(t)
+	release := make(chan struct{})
+	defer close(release)
+	kernel.Handle(jupyter.RequestExecute, func(req *jupyter.RawMessage) jupytertest.Reply {
+		<-release
+		return jupytertest.Reply{Content: jupyter.ExecutionResult{Status: jupyter.StatusOk}}
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, _, err := client.ExecuteContext(ctx, &jupyter.ExecutionRequest{Code: "pass"}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected a deadline exceeded error, got %v", err)
+	}
+	start := time.Now()
+	if err := client.CloseWait(5 * time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("CloseWait waited %v for a discarded execution", elapsed)
+	}
+}
+
+func TestCloseWaitPendingExecution(t *testing.T) {
+	_, client := newTestClient(t)
+	waitForIOPub(t, client)
+	_, ch, err := client.Execute(&jupyter.ExecutionRequest{Code: "print(1)"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	idle := make(chan bool, 1)
+	go func() {
+		var last interface{}
+		for msg := range ch {
+			last = msg
+		}
+		status, ok := last.(*jupyter.StatusMessage)
+		idle <- ok && status.ExecutionState == jupyter.StateIdle
+	}()
+	if err := client.CloseWait(5 * time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if !<-idle {
+		t.Fatal("execution was closed before idle status")
+	}
+}
+
+func TestLastRequest(t *testing.T) {
+	kernel, client := newTestClient(t, jupyter.WithStoreHistory())
+	kernel.Handle(jupyter.RequestExecute, func(req *jupyter.RawMessage) jupytertest.Reply {
+		value, err := kernel.Input(req, "name: ", false)
+		if err != nil {
+			value = err.Error()
+		}
+		return jupytertest.Reply{Content: jupyter.ExecutionResult{Status: jupyter.StatusOk}, IOPub: []jupytertest.Output{
+			{MsgType: "stream", Content: jupyter.StreamMessage{Name: "stdout", Text: value}},
+		}}
+	})
+	_, err := client.ExecuteAndWait(&jupyter.ExecutionRequest{
+		Code: "input('name: ')",
+		OnInput: func(prompt string, password bool) (string, error) {
+			return "go", nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the input_reply sent on the stdin channel is not a request
+	last := client.LastRequest()
+	if last.Header.MsgType != jupyter.RequestExecute {
+		t.Fatalf("expected the execute request, got %s", last.Header.MsgType)
+	}
+	if req, ok := last.Content.(*jupyter.ExecutionRequest); !ok || !req.StoreHistory {
+		t.Fatalf("expected the normalized execute request, got %#v", last.Content)
+	}
+}
+
+// benchSocket is a socket of a benchmarked client, an IOPub socket returns the frames n times.
+type benchSocket struct {
+	zmq4.Socket
+	ctx       context.Context
+	frames    [][]byte
+	n         int
+	received  chan struct{}
+	closed    chan struct{}
+	closeOnce *sync.Once
+}
+
+func newBenchSocket(ctx context.Context, frames [][]byte, n int) *benchSocket {
+	return &benchSocket{
+		ctx:       ctx,
+		frames:    frames,
+		n:         n,
+		closed:    make(chan struct{}),
+		closeOnce: new(sync.Once),
+	}
+}
+
+func (socket *benchSocket) Recv() (zmq4.Msg, error) {
+	if socket.n > 0 {
+		socket.n--
+		return zmq4.NewMsgFrom(socket.frames...), nil
+	}
+	// all messages were handled when the next one is received
+	if socket.frames != nil {
+		close(socket.received)
+		socket.frames = nil
+	}
+	select {
+	case <-socket.ctx.Done():
+	case <-socket.closed:
+	}
+	return zmq4.Msg{}, errors.New("socket closed")
+}
+
+func (socket *benchSocket) Close() error {
+	socket.closeOnce.Do(func() { close(socket.closed) })
+	return nil
+}
+
+func (socket *benchSocket) Dial(string) error                   { return nil }
+func (socket *benchSocket) SetOption(string, interface{}) error { return nil }
+
+// benchSockets creates sockets of a benchmarked client, the IOPub socket returns the frames n times.
+type benchSockets struct {
+	frames   [][]byte
+	n        int
+	received chan struct{}
+}
+
+func (sockets benchSockets) NewDealer(ctx context.Context, opts ...zmq4.Option) zmq4.Socket {
+	return newBenchSocket(ctx, nil, 0)
+}
+
+func (sockets benchSockets) NewSub(ctx context.Context, opts ...zmq4.Option) zmq4.Socket {
+	socket := newBenchSocket(ctx, sockets.frames, sockets.n)
+	socket.received = sockets.received
+	return socket
+}
+
+func (sockets benchSockets) NewReq(ctx context.Context, opts ...zmq4.Option) zmq4.Socket {
+	return newBenchSocket(ctx, nil, 0)
+}
+
+// BenchmarkSessionFilter measures polling of IOPub messages published for another session.
+func BenchmarkSessionFilter(b *testing.B) {
+	msg := jupyter.Message{
+		Header:       jupyter.Header{MsgID: "1", MsgType: "stream", Session: "other", Version: jupyter.Version},
+		ParentHeader: jupyter.Header{MsgID: "0", MsgType: jupyter.RequestExecute, Session: "other", Version: jupyter.Version},
+		Metadata:     map[string]interface{}{},
+		Content:      jupyter.StreamMessage{Name: "stdout", Text: strings.Repeat("output\n", 100)},
+	}
+	encoded, err := msg.Encode(nil)
+	if err != nil {
+		b.Fatal(err)
+	}
+	frames := append([][]byte{[]byte("<IDS|MSG>")}, encoded...)
+	for _, bench := range []struct {
+		name string
+		opts []jupyter.Option
+	}{
+		{"Unfiltered", nil},
+		{"Filtered", []jupyter.Option{jupyter.WithSessionFilter()}},
+	} {
+		b.Run(bench.name, func(b *testing.B) {
+			sockets := benchSockets{frames: frames, n: b.N, received: make(chan struct{})}
+			info := jupyter.ConnectionInfo{Transport: "tcp", IP: "127.0.0.1"}
+			opts := append([]jupyter.Option{jupyter.WithSocketFactory(sockets)}, bench.opts...)
+			b.ResetTimer()
+			client, err := jupyter.NewClient(context.Background(), &info, opts...)
+			if err != nil {
+				b.Fatal(err)
+			}
+			<-sockets.received
+			b.StopTimer()
+			client.Close()
+		})
+	}
+}
+
+func TestCloseDuringOutput(t *testing.T) {
+	kernel, client := newTestClient(t)
+	kernel.Handle(jupyter.RequestExecute, func(req *jupyter.RawMessage) jupytertest.Reply {
+		reply := jupytertest.Reply{Content: jupyter.ExecutionResult{Status: jupyter.StatusOk}}
+		for i := 0; i < 200; i++ {
+			reply.IOPub = append(reply.IOPub, jupytertest.Output{
+				MsgType: "stream",
+				Content: jupyter.StreamMessage{Name: "stdout", Text: "line\n"},
+			})
+		}
+		return reply
+	})
+	waitForIOPub(t, client)
+
+	receiving := new(sync.WaitGroup)
+	started := make(chan struct{}, 4)
+	for i := 0; i < 4; i++ {
+		_, ch, err := client.Execute(&jupyter.ExecutionRequest{Code: "for i in range(200): print('line')"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		receiving.Add(1)
+		go func() {
+			defer receiving.Done()
+			for range ch {
+				select {
+				case started <- struct{}{}:
+				default:
+				}
+			}
+		}()
+	}
+	// close the client while output is delivered to the channels
+	<-started
+	closed := make(chan struct{})
+	go func() {
+		client.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close did not return")
+	}
+	receiving.Wait()
+	if _, _, err := client.Execute(&jupyter.ExecutionRequest{Code: "pass"}); !errors.Is(err, jupyter.ErrClientClosed) {
+		t.Fatalf("expected ErrClientClosed, got %v", err)
+	}
+}
+
+func TestConcurrentExecutionsRouted(t *testing.T) {
+	kernel, client := newTestClient(t)
+	kernel.Handle(jupyter.RequestExecute, func(req *jupyter.RawMessage) jupytertest.Reply {
+		var content jupyter.ExecutionRequest
+		_ = json.Unmarshal(req.Content, &content)
+		return jupytertest.Reply{
+			Content: map[string]interface{}{
+				"status":           "ok",
+				"execution_count":  0,
+				"user_expressions": map[string]interface{}{"code": map[string]interface{}{"data": map[string]interface{}{"text/plain": content.Code}}},
+			},
+			IOPub: []jupytertest.Output{
+				{MsgType: "stream", Content: jupyter.StreamMessage{Name: "stdout", Text: content.Code}},
+			},
+		}
+	})
+	waitForIOPub(t, client)
+
+	executions := new(sync.WaitGroup)
+	errs := make(chan error, 3)
+	for i := 0; i < 3; i++ {
+		executions.Add(1)
+		go func(code string) {
+			defer executions.Done()
+			rep, ch, err := client.Execute(&jupyter.ExecutionRequest{Code: code})
+			if err != nil {
+				errs <- err
+				return
+			}
+			var stdout string
+			for msg := range ch {
+				if stream, ok := msg.(*jupyter.StreamMessage); ok {
+					stdout += stream.Text
+				}
+			}
+			if data, _ := rep.Expression("code"); data.Data["text/plain"] != code {
+				errs <- fmt.Errorf("reply of %q routed to %q", data.Data["text/plain"], code)
+			}
+			if stdout != code {
+				errs <- fmt.Errorf("output %q routed to %q", stdout, code)
+			}
+		}(fmt.Sprintf("print(%d)", i))
+	}
+	executions.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+}
+
+func TestConnectionInfoAddr(t *testing.T) {
+	for _, test := range []struct {
+		info jupyter.ConnectionInfo
+		addr string
+	}{
+		{jupyter.ConnectionInfo{Transport: "tcp", IP: "127.0.0.1", ShellPort: 5555}, "tcp://127.0.0.1:5555"},
+		{jupyter.ConnectionInfo{Transport: "tcp", IP: "::1", ShellPort: 5555}, "tcp://[::1]:5555"},
+		{jupyter.ConnectionInfo{Transport: "ipc", IP: "/tmp/kernel-1", ShellPort: 1}, "ipc:///tmp/kernel-1-1"},
+	} {
+		if addr := test.info.ShellAddr(); addr != test.addr {
+			t.Errorf("expected %s, got %s", test.addr, addr)
+		}
+	}
+}
+
+func TestConnectionFileReloadRetried(t *testing.T) {
+	kernel, client := newTestClient(t)
+	path := t.TempDir() + "/kernel.json"
+	info := kernel.ConnectionInfo()
+	info.Key = "stale"
+	stale, err := jupyter.NewClient(context.Background(), &info, jupyter.WithConnectionFileReload(path, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stale.Close()
+
+	// the first reloads fail reading the missing connection file
+	for i := 0; i < 10; i++ {
+		waitForIOPub(t, client)
+		time.Sleep(10 * time.Millisecond)
+	}
+	info = kernel.ConnectionInfo()
+	if err := info.WriteFile(path); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; stale.SigningKey() != info.Key; i++ {
+		if i == 50 {
+			t.Fatal("connection file was not reloaded")
+		}
+		waitForIOPub(t, client)
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		stale.Ping(ctx)
+		cancel()
+	}
+	if _, err := stale.ExecuteAndWait(&jupyter.ExecutionRequest{Code: "pass"}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// lostEchoSocket is a heartbeat socket never receiving the echo until it is closed.
+type lostEchoSocket struct {
+	zmq4.Socket
+	closed    chan struct{}
+	closeOnce *sync.Once
+}
+
+func (socket *lostEchoSocket) Recv() (zmq4.Msg, error) {
+	<-socket.closed
+	return zmq4.Msg{}, errors.New("socket closed")
+}
+
+func (socket *lostEchoSocket) Close() error {
+	socket.closeOnce.Do(func() { close(socket.closed) })
+	return socket.Socket.Close()
+}
+
+// lostEchoSockets creates go-zeromq sockets, echoes of the first heartbeat socket are lost.
+type lostEchoSockets struct {
+	reqs *atomic.Int32
+}
+
+func (sockets lostEchoSockets) NewDealer(ctx context.Context, opts ...zmq4.Option) zmq4.Socket {
+	return zmq4.NewDealer(ctx, opts...)
+}
+
+func (sockets lostEchoSockets) NewSub(ctx context.Context, opts ...zmq4.Option) zmq4.Socket {
+	return zmq4.NewSub(ctx, opts...)
+}
+
+func (sockets lostEchoSockets) NewReq(ctx context.Context, opts ...zmq4.Option) zmq4.Socket {
+	socket := zmq4.NewReq(ctx, opts...)
+	if sockets.reqs.Add(1) > 1 {
+		return socket
+	}
+	return &lostEchoSocket{Socket: socket, closed: make(chan struct{}), closeOnce: new(sync.Once)}
+}
+
+func TestPingAfterLostEcho(t *testing.T) {
+	_, client := newTestClient(t, jupyter.WithSocketFactory(lostEchoSockets{reqs: new(atomic.Int32)}))
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := client.Ping(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+	ctx, cancel = context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if _, err := client.Ping(ctx); err != nil {
+		t.Fatal(err)
+	}
+}
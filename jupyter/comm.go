@@ -0,0 +1,151 @@
+package jupyter
+
+import "fmt"
+
+// CommOpenMessage represents the content of a comm_open message in the Jupyter protocol.
+// https://jupyter-client.readthedocs.io/en/latest/messaging.html#custom-messages
+type CommOpenMessage struct {
+	Envelope
+
+	// CommID is a unique identifier of the comm.
+	CommID string `json:"comm_id"`
+
+	// TargetName is the name of the target the comm is opened for, e.g. 'jupyter.widget'.
+	TargetName string `json:"target_name"`
+
+	// Data contains arbitrary data sent when opening the comm.
+	Data map[string]interface{} `json:"data"`
+}
+
+// CommMsgMessage represents the content of a comm_msg message in the Jupyter protocol.
+type CommMsgMessage struct {
+	Envelope
+
+	// CommID is the identifier of the comm the message is sent to.
+	CommID string `json:"comm_id"`
+
+	// Data contains arbitrary data of the message.
+	Data map[string]interface{} `json:"data"`
+}
+
+// CommCloseMessage represents the content of a comm_close message in the Jupyter protocol.
+type CommCloseMessage struct {
+	Envelope
+
+	// CommID is the identifier of the closed comm.
+	CommID string `json:"comm_id"`
+
+	// Data contains arbitrary data sent when closing the comm.
+	Data map[string]interface{} `json:"data"`
+}
+
+// CommHandler handles a comm message of a comm with the given id.
+// Handlers are called from the IOPub polling goroutine, they must not block.
+type CommHandler func(commID string, data map[string]interface{})
+
+// commTarget holds handlers registered for a comm target name.
+type commTarget struct {
+	onOpen  CommHandler
+	onMsg   CommHandler
+	onClose CommHandler
+}
+
+// OnCommOpen registers a handler called when the kernel opens a comm with the target name.
+func (client *Client) OnCommOpen(targetName string, handler CommHandler) {
+	client.commLock.Lock()
+	defer client.commLock.Unlock()
+	target := client.commTargets[targetName]
+	target.onOpen = handler
+	client.commTargets[targetName] = target
+}
+
+// OnCommMsg registers a handler called for comm_msg messages sent by the kernel
+// to open comms of the target name.
+func (client *Client) OnCommMsg(targetName string, handler CommHandler) {
+	client.commLock.Lock()
+	defer client.commLock.Unlock()
+	target := client.commTargets[targetName]
+	target.onMsg = handler
+	client.commTargets[targetName] = target
+}
+
+// OnCommClose registers a handler called when the kernel closes an open comm of the target name.
+func (client *Client) OnCommClose(targetName string, handler CommHandler) {
+	client.commLock.Lock()
+	defer client.commLock.Unlock()
+	target := client.commTargets[targetName]
+	target.onClose = handler
+	client.commTargets[targetName] = target
+}
+
+// CommOpen opens a comm with the target name in the kernel and returns its id.
+func (client *Client) CommOpen(targetName string, data map[string]interface{}) (commID string, err error) {
+	commID = client.newID()
+	// the comm is tracked before sending, the kernel can send messages to it right after opening
+	client.commLock.Lock()
+	client.comms[commID] = targetName
+	client.commLock.Unlock()
+	msg := client.createMessage("comm_open", &CommOpenMessage{CommID: commID, TargetName: targetName, Data: data})
+	if err = client.shell.send(msg); err != nil {
+		client.commLock.Lock()
+		delete(client.comms, commID)
+		client.commLock.Unlock()
+		return "", err
+	}
+	return
+}
+
+// CommMsg sends a message to an open comm.
+func (client *Client) CommMsg(commID string, data map[string]interface{}) error {
+	if _, ok := client.commTargetName(commID); !ok {
+		return fmt.Errorf("Comm is not open: %s", commID)
+	}
+	msg := client.createMessage("comm_msg", &CommMsgMessage{CommID: commID, Data: data})
+	return client.shell.send(msg)
+}
+
+// CommClose closes an open comm.
+func (client *Client) CommClose(commID string, data map[string]interface{}) error {
+	if _, ok := client.commTargetName(commID); !ok {
+		return fmt.Errorf("Comm is not open: %s", commID)
+	}
+	client.commLock.Lock()
+	delete(client.comms, commID)
+	client.commLock.Unlock()
+	msg := client.createMessage("comm_close", &CommCloseMessage{CommID: commID, Data: data})
+	return client.shell.send(msg)
+}
+
+func (client *Client) commTargetName(commID string) (string, bool) {
+	client.commLock.Lock()
+	defer client.commLock.Unlock()
+	targetName, ok := client.comms[commID]
+	return targetName, ok
+}
+
+// handleComm tracks comms opened and closed by the kernel and calls registered handlers.
+func (client *Client) handleComm(content interface{}) {
+	client.commLock.Lock()
+	var handler CommHandler
+	var commID string
+	var data map[string]interface{}
+	switch msg := content.(type) {
+	case *CommOpenMessage:
+		client.comms[msg.CommID] = msg.TargetName
+		handler, commID, data = client.commTargets[msg.TargetName].onOpen, msg.CommID, msg.Data
+	case *CommMsgMessage:
+		if targetName, ok := client.comms[msg.CommID]; ok {
+			handler, commID, data = client.commTargets[targetName].onMsg, msg.CommID, msg.Data
+		}
+	case *CommCloseMessage:
+		if targetName, ok := client.comms[msg.CommID]; ok {
+			handler, commID, data = client.commTargets[targetName].onClose, msg.CommID, msg.Data
+		}
+		delete(client.comms, msg.CommID)
+	}
+	client.commLock.Unlock()
+
+	if handler != nil {
+		handler(commID, data)
+	}
+}
@@ -0,0 +1,54 @@
+package jupyter_test
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/crackcomm/go-jupyter/jupyter"
+	"github.com/crackcomm/go-jupyter/jupyter/jupytertest"
+)
+
+func TestCommLifecycle(t *testing.T) {
+	kernel, client := newTestClient(t)
+	// the kernel answers right after the comm is opened and closes it
+	kernel.Handle("comm_open", func(req *jupyter.RawMessage) jupytertest.Reply {
+		var open jupyter.CommOpenMessage
+		if err := json.Unmarshal(req.Content, &open); err != nil {
+			t.Error(err)
+		}
+		return jupytertest.Reply{
+			IOPub: []jupytertest.Output{
+				{MsgType: "comm_msg", Content: map[string]interface{}{"comm_id": open.CommID, "data": map[string]interface{}{"n": 1}}},
+				{MsgType: "comm_close", Content: map[string]interface{}{"comm_id": open.CommID, "data": map[string]interface{}{}}},
+			},
+		}
+	})
+	received := make(chan string, 1)
+	closed := make(chan string, 1)
+	client.OnCommMsg("test", func(commID string, data map[string]interface{}) {
+		received <- commID
+	})
+	client.OnCommClose("test", func(commID string, data map[string]interface{}) {
+		closed <- commID
+	})
+	waitForIOPub(t, client)
+
+	commID, err := client.CommOpen("test", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, ch := range []chan string{received, closed} {
+		select {
+		case id := <-ch:
+			if id != commID {
+				t.Errorf("expected comm %s, got %s", commID, id)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("comm message not handled")
+		}
+	}
+	if err := client.CommMsg(commID, nil); err == nil {
+		t.Error("expected an error sending to a closed comm")
+	}
+}
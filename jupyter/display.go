@@ -0,0 +1,235 @@
+package jupyter
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Select returns the first MIME type from the preference list available in the data,
+// e.g. d.Select("text/html", "text/markdown", "text/plain").
+func (d DisplayData) Select(preferred ...string) (mime string, data interface{}, ok bool) {
+	for _, mime := range preferred {
+		if data, ok := d.Data[mime]; ok {
+			return mime, data, true
+		}
+	}
+	return "", nil, false
+}
+
+// Output types of nbformat v4 notebook cell outputs.
+const (
+	OutputExecuteResult = "execute_result"
+	OutputDisplayData   = "display_data"
+	OutputStream        = "stream"
+	OutputError         = "error"
+)
+
+// ToNotebookOutput returns the nbformat v4 JSON of a notebook cell output,
+// the output type is either OutputDisplayData or OutputExecuteResult.
+// The execution count of an execute_result output is null, it can be set by the caller,
+// ExecuteResultMessage.ToNotebookOutput returns the output with the count of the result.
+// Stream and error outputs are built from StreamMessage and ErrorMessage,
+// other output types return nil.
+func (d DisplayData) ToNotebookOutput(outputType string) map[string]interface{} {
+	data, metadata := d.Data, d.Metadata
+	if data == nil {
+		data = make(map[string]interface{})
+	}
+	if metadata == nil {
+		metadata = make(map[string]interface{})
+	}
+	switch outputType {
+	case OutputDisplayData:
+		return map[string]interface{}{
+			"output_type": outputType,
+			"data":        data,
+			"metadata":    metadata,
+		}
+	case OutputExecuteResult:
+		return map[string]interface{}{
+			"output_type":     outputType,
+			"data":            data,
+			"metadata":        metadata,
+			"execution_count": nil,
+		}
+	default:
+		return nil
+	}
+}
+
+// ToNotebookOutput returns the nbformat v4 JSON of the execute_result output with its execution count.
+func (msg *ExecuteResultMessage) ToNotebookOutput() map[string]interface{} {
+	output := DisplayData{Data: msg.Data, Metadata: msg.Metadata}.ToNotebookOutput(OutputExecuteResult)
+	output["execution_count"] = msg.ExecutionCount
+	return output
+}
+
+// ToNotebookOutput returns the nbformat v4 JSON of the stream output.
+func (msg *StreamMessage) ToNotebookOutput() map[string]interface{} {
+	return map[string]interface{}{
+		"output_type": OutputStream,
+		"name":        msg.Name,
+		"text":        msg.Text,
+	}
+}
+
+// ToNotebookOutput returns the nbformat v4 JSON of the error output.
+func (msg *ErrorMessage) ToNotebookOutput() map[string]interface{} {
+	traceback := msg.Traceback
+	if traceback == nil {
+		traceback = []string{}
+	}
+	return map[string]interface{}{
+		"output_type": OutputError,
+		"ename":       msg.EName,
+		"evalue":      msg.EValue,
+		"traceback":   traceback,
+	}
+}
+
+// PlainText returns the text/plain representation of the data, or an empty string if there is none.
+func (d DisplayData) PlainText() string {
+	text, _ := d.Data["text/plain"].(string)
+	return text
+}
+
+// DefaultInspectMIMETypes are the representations of inspect replies preferred by InspectReply.Render by default.
+var DefaultInspectMIMETypes = []string{"text/markdown", "text/plain"}
+
+// Render writes the first representation of the inspected object from the preference list,
+// e.g. r.Render(os.Stdout, "text/markdown", "text/plain"), it defaults to DefaultInspectMIMETypes.
+// Representations which are not text are written as JSON. An error is returned if none is available.
+func (r InspectReply) Render(w io.Writer, preferred ...string) error {
+	if len(preferred) == 0 {
+		preferred = DefaultInspectMIMETypes
+	}
+	mime, data, ok := DisplayData{Data: r.Data, Metadata: r.Metadata}.Select(preferred...)
+	if !ok {
+		return fmt.Errorf("No %s representation in inspect reply", strings.Join(preferred, " or "))
+	}
+	if text, ok := data.(string); ok {
+		_, err := io.WriteString(w, text)
+		return err
+	}
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("Error encoding %s: %w", mime, err)
+	}
+	_, err = w.Write(encoded)
+	return err
+}
+
+// SaveImage writes the image representation of the MIME type to a file.
+// Binary images, e.g. image/png or image/jpeg, are sent base64-encoded and are decoded,
+// text images, e.g. image/svg+xml, are written as they are.
+func (d DisplayData) SaveImage(mime, path string) error {
+	value, ok := d.Data[mime]
+	if !ok {
+		return fmt.Errorf("No %s representation in display data", mime)
+	}
+	text, ok := value.(string)
+	if !ok {
+		return fmt.Errorf("Unexpected %s representation type: %T", mime, value)
+	}
+	var data []byte
+	switch mime {
+	case "image/svg+xml":
+		data = []byte(text)
+	case "image/png", "image/jpeg", "image/gif", "image/bmp", "image/webp":
+		decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(text))
+		if err != nil {
+			return fmt.Errorf("Error decoding %s: %w", mime, err)
+		}
+		data = decoded
+	default:
+		return fmt.Errorf("Unsupported image type: %s", mime)
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// Update replaces the data and metadata with the content of an update_display_data message,
+// as frontends do for the output displayed with the same display_id.
+// Transient data is replaced as well, keeping the display_id if the update omits it.
+func (d *DisplayData) Update(msg *UpdateDisplayDataMessage) {
+	d.Data = msg.Data
+	d.Metadata = msg.Metadata
+	id, hadID := displayID(d.Transient)
+	d.Transient = msg.Transient
+	if _, ok := displayID(d.Transient); hadID && !ok {
+		transient := make(map[string]interface{}, len(d.Transient)+1)
+		for key, value := range d.Transient {
+			transient[key] = value
+		}
+		transient["display_id"] = id
+		d.Transient = transient
+	}
+}
+
+// DisplayID returns the display_id from the transient data, if present.
+func (d DisplayData) DisplayID() (string, bool) {
+	return displayID(d.Transient)
+}
+
+// DisplayTracker keeps outputs displayed with a display_id up to date,
+// applying update_display_data messages, e.g. to render several independently updating
+// outputs of a cell. Updates may come from later executions, so a tracker can be fed
+// messages of multiple executions. It is safe for concurrent use.
+type DisplayTracker struct {
+	lock     *sync.RWMutex
+	displays map[string]*DisplayData
+}
+
+// NewDisplayTracker creates an empty display tracker.
+func NewDisplayTracker() *DisplayTracker {
+	return &DisplayTracker{
+		lock:     new(sync.RWMutex),
+		displays: make(map[string]*DisplayData),
+	}
+}
+
+// Handle tracks a display_data message with a display_id or applies an update_display_data message,
+// it returns the display_id if the message changed a tracked display.
+// Updates of displays not seen before are tracked as new displays.
+// Handle can be used in callbacks of ExecuteStream.
+func (tracker *DisplayTracker) Handle(msg interface{}) (id string, ok bool) {
+	switch msg := msg.(type) {
+	case *DisplayDataMessage:
+		if id, ok = msg.DisplayID(); !ok {
+			return
+		}
+		tracker.lock.Lock()
+		defer tracker.lock.Unlock()
+		display := msg.Display()
+		tracker.displays[id] = &display
+	case *UpdateDisplayDataMessage:
+		if id, ok = msg.DisplayID(); !ok {
+			return
+		}
+		tracker.lock.Lock()
+		defer tracker.lock.Unlock()
+		display, exists := tracker.displays[id]
+		if !exists {
+			display = new(DisplayData)
+			tracker.displays[id] = display
+		}
+		display.Update(msg)
+	}
+	return
+}
+
+// Displays returns copies of the tracked displays by display_id.
+func (tracker *DisplayTracker) Displays() map[string]*DisplayData {
+	tracker.lock.RLock()
+	defer tracker.lock.RUnlock()
+	displays := make(map[string]*DisplayData, len(tracker.displays))
+	for id, display := range tracker.displays {
+		copied := *display
+		displays[id] = &copied
+	}
+	return displays
+}
@@ -0,0 +1,24 @@
+package jupyter_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/crackcomm/go-jupyter/jupyter"
+)
+
+func TestExecuteResultNotebookOutput(t *testing.T) {
+	msg := &jupyter.ExecuteResultMessage{
+		ExecutionCount: 3,
+		Data:           map[string]interface{}{"text/plain": "2"},
+	}
+	expected := map[string]interface{}{
+		"output_type":     jupyter.OutputExecuteResult,
+		"data":            map[string]interface{}{"text/plain": "2"},
+		"metadata":        map[string]interface{}{},
+		"execution_count": 3,
+	}
+	if output := msg.ToNotebookOutput(); !reflect.DeepEqual(output, expected) {
+		t.Errorf("expected %v, got %v", expected, output)
+	}
+}
@@ -1,5 +1,11 @@
 // Package jupyterclient provides a simple Jupyter Protocol client for communication with Jupyter kernels.
 //
-// Note: Currently, the package does not support stdin prompting as described in
-// https://jupyter-protocol.readthedocs.io/en/latest/messaging.html#messages-on-the-stdin-router-dealer-channel
+// IOPub messages caused by an execution are delivered on a channel returned by Client.Execute
+// in the order they were published, from the busy status message to the idle status message,
+// after which the channel is closed. Messages are delivered by a single goroutine in the order
+// of arrival on the IOPub socket, numbered by Envelope.ArrivalSeq, also across concurrent executions.
+//
+// Input requests of executions, see
+// https://jupyter-protocol.readthedocs.io/en/latest/messaging.html#messages-on-the-stdin-router-dealer-channel,
+// are answered by ExecutionRequest.OnInput.
 package jupyter
@@ -0,0 +1,267 @@
+package jupyter
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+)
+
+// ExecuteStream executes the request and calls onMsg for each IOPub message
+// until the kernel reports idle status for the request.
+// If onMsg returns an error, remaining messages are discarded and the error is returned.
+func (client *Client) ExecuteStream(req *ExecutionRequest, onMsg func(interface{}) error, opts ...MessageOption) (rep ExecutionResult, err error) {
+	return client.ExecuteStreamContext(context.Background(), req, onMsg, opts...)
+}
+
+// ExecuteStreamContext is like ExecuteStream, but it returns the context error
+// if the context is done before the kernel reports idle status, see ExecuteContext.
+// Messages received until then were passed to onMsg.
+// If the channel is closed before idle status for another reason, e.g. the execution timed out
+// or the client was closed, the respective error is returned as well.
+func (client *Client) ExecuteStreamContext(ctx context.Context, req *ExecutionRequest, onMsg func(interface{}) error, opts ...MessageOption) (rep ExecutionResult, err error) {
+	// the execution timeout is applied here, so it's reported as the context error
+	ctx, cancel := client.withExecutionTimeout(ctx)
+	defer cancel()
+	rep, ch, err := client.executeResult(ctx, cancel, req, opts...)
+	if err != nil {
+		return
+	}
+	idle := req.Silent
+	for msg := range ch {
+		if err = onMsg(msg); err != nil {
+			go drain(ch)
+			return
+		}
+		status, ok := msg.(*StatusMessage)
+		idle = ok && status.ExecutionState == StateIdle
+	}
+	if !idle {
+		if err = ctx.Err(); err == nil && client.isClosing() {
+			err = ErrClientClosed
+		} else if err == nil {
+			err = ErrOutputIncomplete
+		}
+	}
+	return
+}
+
+// CollectOutputs receives messages until the channel is closed or the context is done,
+// in which case the messages received so far are returned with the context error.
+func CollectOutputs(ctx context.Context, ch <-chan interface{}) (msgs []interface{}, err error) {
+	for {
+		select {
+		case <-ctx.Done():
+			go drain(ch)
+			return msgs, ctx.Err()
+		case msg, ok := <-ch:
+			if !ok {
+				return msgs, nil
+			}
+			msgs = append(msgs, msg)
+		}
+	}
+}
+
+// ExecuteAndWait executes the request and waits until the kernel reports idle status.
+// The data of the execute_result message, e.g. the value of the last expression, is set as Result of the reply.
+func (client *Client) ExecuteAndWait(req *ExecutionRequest, opts ...MessageOption) (ExecutionResult, error) {
+	return client.ExecuteAndWaitContext(context.Background(), req, opts...)
+}
+
+// ExecuteAndWaitContext is like ExecuteAndWait, but it returns the context error
+// with the reply and the result received so far if the context is done before the kernel reports idle status.
+func (client *Client) ExecuteAndWaitContext(ctx context.Context, req *ExecutionRequest, opts ...MessageOption) (ExecutionResult, error) {
+	var result *DisplayData
+	rep, err := client.ExecuteStreamContext(ctx, req, func(msg interface{}) error {
+		if msg, ok := msg.(*ExecuteResultMessage); ok {
+			display := msg.Display()
+			result = &display
+		}
+		return nil
+	}, opts...)
+	rep.Result = result
+	return rep, err
+}
+
+// ExecutionOutput is the reply and the output of an execution run to idle status.
+type ExecutionOutput struct {
+	// Reply is the execute reply of the kernel, see ExecutionResult.Err.
+	Reply ExecutionResult
+
+	// Stdout and Stderr contain text written to the streams.
+	Stdout, Stderr string
+
+	// Results contains the data of execute_result messages, e.g. the value of the last expression.
+	Results []DisplayData
+
+	// Error is the error message published if the execution raised an exception.
+	Error *ErrorMessage
+
+	// DisplayData contains data displayed by the execution, e.g. plots.
+	DisplayData []DisplayData
+}
+
+// Run executes the request and collects its output until the kernel reports idle status.
+// A failed execution is not an error of Run, it is reported in the output.
+func (client *Client) Run(req *ExecutionRequest, opts ...MessageOption) (out ExecutionOutput, err error) {
+	return client.RunContext(context.Background(), req, opts...)
+}
+
+// RunContext is like Run, but it returns the context error with the output collected so far
+// if the context is done before the kernel reports idle status.
+func (client *Client) RunContext(ctx context.Context, req *ExecutionRequest, opts ...MessageOption) (out ExecutionOutput, err error) {
+	var stdout, stderr strings.Builder
+	out.Reply, err = client.ExecuteStreamContext(ctx, req, func(msg interface{}) error {
+		switch msg := msg.(type) {
+		case *StreamMessage:
+			return WriteStream(msg, &stdout, &stderr)
+		case *ExecuteResultMessage:
+			out.Results = append(out.Results, msg.Display())
+		case *DisplayDataMessage:
+			out.DisplayData = append(out.DisplayData, msg.Display())
+		case *ErrorMessage:
+			out.Error = msg
+		}
+		return nil
+	}, opts...)
+	out.Stdout, out.Stderr = stdout.String(), stderr.String()
+	return
+}
+
+// ExecuteBatch executes the requests one after another, waiting for each to reach idle status,
+// and returns their replies. If stopOnError is true, the batch stops at the first execution that fails,
+// returning the replies so far, including the failed one, with the error of its reply.
+func (client *Client) ExecuteBatch(reqs []*ExecutionRequest, stopOnError bool) ([]ExecutionResult, error) {
+	results := make([]ExecutionResult, 0, len(reqs))
+	for _, req := range reqs {
+		batched := *req
+		batched.StopOnError = stopOnError
+		rep, err := client.ExecuteStream(&batched, func(interface{}) error { return nil })
+		if err != nil {
+			return results, err
+		}
+		results = append(results, rep)
+		if err := rep.Err(); err != nil && stopOnError {
+			return results, err
+		}
+	}
+	return results, nil
+}
+
+// ExecuteTo executes the request, writing stream output to stdout and stderr as it arrives,
+// and returns the reply when the kernel reports idle status. A nil writer discards its stream.
+func (client *Client) ExecuteTo(req *ExecutionRequest, stdout, stderr io.Writer, opts ...MessageOption) (ExecutionResult, error) {
+	return client.ExecuteStream(req, func(msg interface{}) error {
+		return WriteStream(msg, stdout, stderr)
+	}, opts...)
+}
+
+// ExecuteReader executes the request and returns a reader of the text written to stdout as it arrives,
+// with the reply of the kernel, e.g. to scan output lines with bufio.Scanner.
+// The reader returns io.EOF when the kernel reports idle status. Closing it discards remaining output.
+// If the output ends before idle status, reading fails with ErrClientClosed if the client was closed,
+// or with ErrOutputIncomplete otherwise, e.g. when the execution timed out or was abandoned.
+func (client *Client) ExecuteReader(req *ExecutionRequest, opts ...MessageOption) (io.ReadCloser, *ExecutionResult, error) {
+	return client.executeReader(req, false, opts...)
+}
+
+// ExecuteCombinedReader is like ExecuteReader, but the reader returns the text written to both stdout and stderr.
+func (client *Client) ExecuteCombinedReader(req *ExecutionRequest, opts ...MessageOption) (io.ReadCloser, *ExecutionResult, error) {
+	return client.executeReader(req, true, opts...)
+}
+
+func (client *Client) executeReader(req *ExecutionRequest, combined bool, opts ...MessageOption) (io.ReadCloser, *ExecutionResult, error) {
+	rep, ch, err := client.Execute(req, opts...)
+	if err != nil {
+		return nil, nil, err
+	}
+	r, w := io.Pipe()
+	var stderr io.Writer
+	if combined {
+		stderr = w
+	}
+	go func() {
+		idle := req.Silent
+		for msg := range ch {
+			if err := WriteStream(msg, w, stderr); err != nil {
+				// the reader was closed
+				drain(ch)
+				return
+			}
+			status, ok := msg.(*StatusMessage)
+			idle = ok && status.ExecutionState == StateIdle
+		}
+		if idle {
+			w.Close()
+		} else if client.isClosing() {
+			w.CloseWithError(ErrClientClosed)
+		} else {
+			w.CloseWithError(ErrOutputIncomplete)
+		}
+	}()
+	return r, &rep, nil
+}
+
+// CollectLast receives messages until the channel is closed and returns the last n messages in order.
+// Earlier messages are dropped as they arrive, so memory is bounded when tailing chatty executions.
+func CollectLast(ch <-chan interface{}, n int) []interface{} {
+	if n <= 0 {
+		drain(ch)
+		return nil
+	}
+	ring := make([]interface{}, 0, n)
+	next := 0
+	for msg := range ch {
+		if len(ring) < n {
+			ring = append(ring, msg)
+			continue
+		}
+		ring[next] = msg
+		next = (next + 1) % n
+	}
+	return append(ring[next:], ring[:next]...)
+}
+
+// drain discards all messages until the channel is closed.
+func drain(ch <-chan interface{}) {
+	for range ch {
+	}
+}
+
+// userExpression is a result of a user expression, it is either data or an error.
+type userExpression struct {
+	DisplayData
+	Status    Status   `json:"status"`
+	EName     string   `json:"ename"`
+	EValue    string   `json:"evalue"`
+	Traceback []string `json:"traceback"`
+}
+
+// Eval evaluates the expression in the kernel with a silent execution and returns its rich representation.
+// A failed evaluation returns a *KernelError.
+func (client *Client) Eval(expr string, opts ...MessageOption) (DisplayData, error) {
+	req := &ExecutionRequest{
+		Silent:          true,
+		UserExpressions: map[string]string{"value": expr},
+	}
+	var rep struct {
+		userExpression
+		UserExpressions map[string]userExpression `json:"user_expressions"`
+	}
+	ctx, cancel := client.withExecutionTimeout(context.Background())
+	if _, err := client.executeContext(ctx, cancel, req, &rep, opts...); err != nil {
+		return DisplayData{}, err
+	}
+	if rep.Status != StatusOk {
+		return DisplayData{}, &KernelError{EName: rep.EName, EValue: rep.EValue, Traceback: rep.Traceback}
+	}
+	value, ok := rep.UserExpressions["value"]
+	if !ok {
+		return DisplayData{}, errors.New("Kernel did not evaluate the expression")
+	}
+	if value.Status != StatusOk {
+		return DisplayData{}, &KernelError{EName: value.EName, EValue: value.EValue, Traceback: value.Traceback}
+	}
+	return value.DisplayData, nil
+}
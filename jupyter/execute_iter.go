@@ -0,0 +1,23 @@
+//go:build go1.23
+
+package jupyter
+
+import "iter"
+
+// ExecuteSeq executes the request like Execute and returns the reply with a sequence of its IOPub messages.
+// The sequence ends when the kernel reports idle status, it can be iterated once.
+// Messages remaining after the iteration is stopped are discarded.
+func (client *Client) ExecuteSeq(req *ExecutionRequest, opts ...MessageOption) (ExecutionResult, iter.Seq[interface{}], error) {
+	rep, ch, err := client.Execute(req, opts...)
+	if err != nil {
+		return rep, nil, err
+	}
+	return rep, func(yield func(interface{}) bool) {
+		for msg := range ch {
+			if !yield(msg) {
+				go drain(ch)
+				return
+			}
+		}
+	}, nil
+}
@@ -0,0 +1,38 @@
+//go:build go1.23
+
+package jupyter_test
+
+import (
+	"testing"
+
+	"github.com/crackcomm/go-jupyter/jupyter"
+)
+
+func TestExecuteSeq(t *testing.T) {
+	_, client := newTestClient(t)
+	waitForIOPub(t, client)
+	rep, msgs, err := client.ExecuteSeq(&jupyter.ExecutionRequest{Code: "print(1)"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rep.Status != jupyter.StatusOk {
+		t.Fatalf("unexpected status %q", rep.Status)
+	}
+	var inputs []string
+	for msg := range msgs {
+		if input, ok := msg.(*jupyter.ExecuteInputMessage); ok {
+			inputs = append(inputs, input.Code)
+		}
+	}
+	if len(inputs) != 1 || inputs[0] != "print(1)" {
+		t.Fatalf("unexpected execute_input messages %q", inputs)
+	}
+}
+
+func TestExecuteSeqClosed(t *testing.T) {
+	_, client := newTestClient(t)
+	client.Close()
+	if _, msgs, err := client.ExecuteSeq(&jupyter.ExecutionRequest{Code: "print(1)"}); err == nil || msgs != nil {
+		t.Fatalf("expected an error without a sequence, got %v", err)
+	}
+}
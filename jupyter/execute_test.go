@@ -0,0 +1,103 @@
+package jupyter_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/crackcomm/go-jupyter/jupyter"
+	"github.com/crackcomm/go-jupyter/jupyter/jupytertest"
+)
+
+func TestExecuteStreamTimeout(t *testing.T) {
+	_, client := newTestClient(t, jupyter.WithExecutionTimeout(100*time.Millisecond))
+	_, err := client.ExecuteStream(&jupyter.ExecutionRequest{Code: "print(1)"}, func(msg interface{}) error {
+		// the execution times out while the first message is handled
+		time.Sleep(200 * time.Millisecond)
+		return nil
+	})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected a deadline exceeded error, got %v", err)
+	}
+}
+
+func TestEval(t *testing.T) {
+	kernel, client := newTestClient(t)
+	kernel.Handle(jupyter.RequestExecute, func(req *jupyter.RawMessage) jupytertest.Reply {
+		var content jupyter.ExecutionRequest
+		_ = json.Unmarshal(req.Content, &content)
+		value := map[string]interface{}{
+			"status": "ok",
+			"data":   map[string]interface{}{"text/plain": content.UserExpressions["value"]},
+		}
+		if content.UserExpressions["value"] == "undefined" {
+			value = map[string]interface{}{"status": "error", "ename": "NameError", "evalue": "name 'undefined' is not defined"}
+		}
+		return jupytertest.Reply{Content: map[string]interface{}{
+			"status":           "ok",
+			"execution_count":  0,
+			"user_expressions": map[string]interface{}{"value": value},
+		}}
+	})
+	data, err := client.Eval("1 + 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data.Data["text/plain"] != "1 + 1" {
+		t.Fatalf("unexpected data %v", data.Data)
+	}
+	var kernelErr *jupyter.KernelError
+	if _, err := client.Eval("undefined"); !errors.As(err, &kernelErr) || kernelErr.EName != "NameError" {
+		t.Fatalf("expected a NameError, got %v", err)
+	}
+	if n := len(client.PendingExecutions()); n != 0 {
+		t.Fatalf("expected no pending executions, got %d", n)
+	}
+}
+
+func TestExecuteReaderIncomplete(t *testing.T) {
+	kernel, client := newTestClient(t)
+	kernel.Handle(jupyter.RequestExecute, func(req *jupyter.RawMessage) jupytertest.Reply {
+		reply := jupytertest.Reply{Content: jupyter.ExecutionResult{Status: jupyter.StatusOk}}
+		for i := 0; i < 100; i++ {
+			reply.IOPub = append(reply.IOPub, jupytertest.Output{
+				MsgType: "stream",
+				Content: jupyter.StreamMessage{Name: "stdout", Text: "line\n"},
+			})
+		}
+		return reply
+	})
+	waitForIOPub(t, client)
+
+	r, _, err := client.ExecuteReader(&jupyter.ExecutionRequest{Code: "for i in range(100): print('line')"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	output, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := strings.Repeat("line\n", 100); string(output) != expected {
+		t.Fatalf("expected %d bytes of output, got %d", len(expected), len(output))
+	}
+
+	r, _, err = client.ExecuteReader(&jupyter.ExecutionRequest{Code: "for i in range(100): print('line')"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// abandon the execution after the first line
+	if _, err := bufio.NewReader(r).ReadString('\n'); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Reconnect(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.ReadAll(r); !errors.Is(err, jupyter.ErrOutputIncomplete) {
+		t.Fatalf("expected ErrOutputIncomplete, got %v", err)
+	}
+}
@@ -0,0 +1,91 @@
+package jupyter
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-zeromq/zmq4"
+	"github.com/google/uuid"
+)
+
+// Ping sends a heartbeat echo to the kernel and returns the round-trip time.
+// The heartbeat socket is connected on the first call.
+// It waits until the context is done or the timeout set with WithRecvTimeout passes.
+// The socket of an echo that was not received is closed and the next call connects again.
+func (client *Client) Ping(ctx context.Context) (time.Duration, error) {
+	if client.recvTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, client.recvTimeout)
+		defer cancel()
+	}
+	type result struct {
+		rtt time.Duration
+		err error
+	}
+	done := make(chan result, 1)
+	go func() {
+		rtt, err := client.ping(ctx)
+		done <- result{rtt, err}
+	}()
+	select {
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	case res := <-done:
+		return res.rtt, res.err
+	}
+}
+
+func (client *Client) ping(ctx context.Context) (time.Duration, error) {
+	client.hbLock.Lock()
+	defer client.hbLock.Unlock()
+	// the context may be done while waiting for a previous ping
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	if client.heartbeat == nil {
+		heartbeat := client.sockets.NewReq(client.ctx, client.socketOptions()...)
+		if err := client.dial(heartbeat, client.hbAddr); err != nil {
+			return 0, fmt.Errorf("HeartBeat connection error: %w", err)
+		}
+		client.heartbeat = heartbeat
+	}
+
+	heartbeat := client.heartbeat
+	payload := []byte(uuid.New().String())
+	start := time.Now()
+	echoed := make(chan error, 1)
+	go func() {
+		echoed <- echo(heartbeat, payload)
+	}()
+	var err error
+	select {
+	case <-ctx.Done():
+		err = ctx.Err()
+	case err = <-echoed:
+	}
+	if err != nil {
+		// a REQ socket can't send again until the echo is received, closing it unblocks the receive
+		heartbeat.Close()
+		client.heartbeat = nil
+		return 0, err
+	}
+	return time.Since(start), nil
+}
+
+// echo sends the payload on the heartbeat socket and checks that it is echoed back.
+func echo(heartbeat zmq4.Socket, payload []byte) error {
+	if err := heartbeat.Send(zmq4.NewMsg(payload)); err != nil {
+		return fmt.Errorf("Error sending heartbeat: %w", err)
+	}
+	msg, err := heartbeat.Recv()
+	if err != nil {
+		return fmt.Errorf("Error receiving heartbeat: %w", err)
+	}
+	if !bytes.Equal(msg.Bytes(), payload) {
+		return errors.New("Invalid heartbeat echo")
+	}
+	return nil
+}
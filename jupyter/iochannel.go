@@ -0,0 +1,81 @@
+package jupyter
+
+import (
+	"errors"
+	"sync"
+)
+
+// ErrChannelClosed is returned when a message is sent to a closed IO channel.
+var ErrChannelClosed = errors.New("IO channel is closed")
+
+// ioChannel delivers IOPub messages of a single request.
+// Sending and closing are coordinated so closing never races with a pending send.
+type ioChannel struct {
+	ch        chan interface{}
+	done      chan struct{}
+	closeOnce *sync.Once
+
+	// Lock held while sending and closing the channel.
+	lock      *sync.Mutex
+	closed    bool
+	discarded bool
+}
+
+func newIOChannel() *ioChannel {
+	return &ioChannel{
+		ch:        make(chan interface{}),
+		done:      make(chan struct{}),
+		closeOnce: new(sync.Once),
+		lock:      new(sync.Mutex),
+	}
+}
+
+// send blocks until the message is received or the channel is closed.
+func (c *ioChannel) send(msg interface{}) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.discarded {
+		return nil
+	}
+	if c.closed {
+		return ErrChannelClosed
+	}
+	select {
+	case c.ch <- msg:
+		return nil
+	case <-c.done:
+		return ErrChannelClosed
+	}
+}
+
+// close aborts a pending send and closes the channel.
+func (c *ioChannel) close() {
+	c.closeOnce.Do(func() {
+		close(c.done)
+	})
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if !c.closed {
+		c.closed = true
+		close(c.ch)
+	}
+}
+
+// discard closes the channel and drops all following messages.
+func (c *ioChannel) discard() {
+	c.close()
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.discarded = true
+}
+
+// isClosed returns true if the channel was closed or discarded.
+// It doesn't wait for the lock, which is held by a send blocked on a receiver that is gone.
+func (c *ioChannel) isClosed() bool {
+	select {
+	case <-c.done:
+		return true
+	default:
+		return false
+	}
+}
@@ -2,11 +2,48 @@ package jupyter
 
 import (
 	"encoding/json"
-	"fmt"
+	"regexp"
+	"strings"
+	"sync"
 )
 
+// Envelope carries the message-level fields of a received IOPub message.
+// It is embedded in all IOPub message types and is not part of the message content.
+type Envelope struct {
+	// Header contains the message header.
+	Header Header `json:"-"`
+
+	// ParentHeader contains the header of the request that caused the message.
+	ParentHeader Header `json:"-"`
+
+	// Metadata contains the message metadata, not to be confused with the
+	// metadata of a display data content.
+	Metadata map[string]interface{} `json:"-"`
+
+	// Buffers contains the optional binary buffers sent after the content.
+	Buffers [][]byte `json:"-"`
+
+	// ArrivalSeq is the position of the message in the order of arrival on the IOPub socket of the client,
+	// starting at one. Messages are delivered in the order of arrival, so the sequence
+	// of messages delivered on a channel returned by Execute is increasing.
+	ArrivalSeq uint64 `json:"-"`
+}
+
+func (envelope *Envelope) setEnvelope(msg *RawMessage) {
+	envelope.Header = msg.Header
+	envelope.ParentHeader = msg.ParentHeader
+	envelope.Metadata = msg.Metadata
+	envelope.Buffers = msg.Buffers
+}
+
+func (envelope *Envelope) setArrivalSeq(seq uint64) {
+	envelope.ArrivalSeq = seq
+}
+
 // StreamMessage represents the content of a stream message in the Jupyter protocol.
 type StreamMessage struct {
+	Envelope
+
 	// Name of the stream, one of 'stdout', 'stderr'.
 	Name string `json:"name"`
 
@@ -16,6 +53,8 @@ type StreamMessage struct {
 
 // DisplayDataMessage represents the content of a display_data message in the Jupyter protocol.
 type DisplayDataMessage struct {
+	Envelope
+
 	// Data contains key/value pairs, where keys are MIME types, and values are raw data of the representation in that format.
 	Data map[string]interface{} `json:"data"`
 
@@ -27,8 +66,15 @@ type DisplayDataMessage struct {
 	Transient map[string]interface{} `json:"transient"`
 }
 
+// Display returns the displayed data.
+func (msg *DisplayDataMessage) Display() DisplayData {
+	return DisplayData{Data: msg.Data, Metadata: msg.Metadata, Transient: msg.Transient}
+}
+
 // UpdateDisplayDataMessage represents the content of an update_display_data message in the Jupyter protocol.
 type UpdateDisplayDataMessage struct {
+	Envelope
+
 	// Data contains key/value pairs, where keys are MIME types, and values are raw data of the representation in that format.
 	Data map[string]interface{} `json:"data"`
 
@@ -41,10 +87,32 @@ type UpdateDisplayDataMessage struct {
 	Transient map[string]interface{} `json:"transient"`
 }
 
+// DisplayID returns the display_id from the transient data, if present.
+func (msg *DisplayDataMessage) DisplayID() (string, bool) {
+	return displayID(msg.Transient)
+}
+
+// DisplayID returns the display_id from the transient data, if present.
+//
+// An update_display_data message replaces the output of an earlier display_data
+// message carrying the same display_id. Clients implementing in-place updates
+// (progress bars, animations) should keep displayed outputs keyed by DisplayID
+// and replace them when an update with a matching DisplayID arrives.
+func (msg *UpdateDisplayDataMessage) DisplayID() (string, bool) {
+	return displayID(msg.Transient)
+}
+
+func displayID(transient map[string]interface{}) (string, bool) {
+	id, ok := transient["display_id"].(string)
+	return id, ok && id != ""
+}
+
 // ClearOutputMessage represents a Jupyter message for clearing output.
 // This message type is used to clear the output, optionally waiting for new output to be available.
 // Useful for creating animations with minimal flickering.
 type ClearOutputMessage struct {
+	Envelope
+
 	// Wait indicates whether to clear the output immediately before new output is displayed.
 	// If true, the output is cleared only when new output is available.
 	Wait bool `json:"wait"`
@@ -52,6 +120,8 @@ type ClearOutputMessage struct {
 
 // ExecuteInputMessage represents the content of an execute_input message in the Jupyter protocol.
 type ExecuteInputMessage struct {
+	Envelope
+
 	// Code is the source code to be executed, one or more lines.
 	Code string `json:"code"`
 
@@ -59,8 +129,25 @@ type ExecuteInputMessage struct {
 	ExecutionCount int `json:"execution_count"`
 }
 
+// UnmarshalJSON implements the json.Unmarshaler interface for ExecuteInputMessage,
+// accepting an execution count encoded as a float, see executionCount.
+func (msg *ExecuteInputMessage) UnmarshalJSON(data []byte) error {
+	type plain ExecuteInputMessage
+	parsed := struct {
+		*plain
+		ExecutionCount executionCount `json:"execution_count"`
+	}{plain: (*plain)(msg)}
+	if err := json.Unmarshal(data, &parsed); err != nil {
+		return err
+	}
+	msg.ExecutionCount = int(parsed.ExecutionCount)
+	return nil
+}
+
 // ExecuteResultMessage represents the content of an execute_result message in the Jupyter protocol.
 type ExecuteResultMessage struct {
+	Envelope
+
 	// ExecutionCount is the counter for this execution.
 	ExecutionCount int `json:"execution_count"`
 
@@ -70,8 +157,31 @@ type ExecuteResultMessage struct {
 	Metadata map[string]interface{} `json:"metadata"`
 }
 
+// UnmarshalJSON implements the json.Unmarshaler interface for ExecuteResultMessage,
+// accepting an execution count encoded as a float, see executionCount.
+func (msg *ExecuteResultMessage) UnmarshalJSON(data []byte) error {
+	type plain ExecuteResultMessage
+	parsed := struct {
+		*plain
+		ExecutionCount executionCount `json:"execution_count"`
+	}{plain: (*plain)(msg)}
+	if err := json.Unmarshal(data, &parsed); err != nil {
+		return err
+	}
+	msg.ExecutionCount = int(parsed.ExecutionCount)
+	return nil
+}
+
+// Display returns the data of the result, so it can be handled like display data.
+// The execution count is not part of the display data.
+func (msg *ExecuteResultMessage) Display() DisplayData {
+	return DisplayData{Data: msg.Data, Metadata: msg.Metadata}
+}
+
 // ErrorMessage represents the content of an error message in the Jupyter protocol.
 type ErrorMessage struct {
+	Envelope
+
 	// EName is the exception name, as a string.
 	EName string `json:"ename"`
 
@@ -82,6 +192,40 @@ type ErrorMessage struct {
 	Traceback []string `json:"traceback"`
 }
 
+// ExecuteReplyMessage represents an execute_reply published on IOPub by some kernels
+// in addition to the shell channel. The reply returned by Execute is the one received on the shell channel.
+type ExecuteReplyMessage struct {
+	Envelope
+	ExecutionResult
+}
+
+// ansiSGR matches ANSI Select Graphic Rendition escape sequences, e.g. color codes.
+var ansiSGR = regexp.MustCompile("\x1b\\[[0-9;]*m")
+
+// PlainTraceback returns the traceback frames joined with newlines, with ANSI color codes stripped.
+func (msg *ErrorMessage) PlainTraceback() string {
+	return ansiSGR.ReplaceAllString(strings.Join(msg.Traceback, "\n"), "")
+}
+
+// DebugEventMessage represents the content of a debug_event message in the Jupyter protocol.
+// The content is an event of the Debug Adapter Protocol.
+// https://jupyter-client.readthedocs.io/en/latest/messaging.html#debug-event
+type DebugEventMessage struct {
+	Envelope
+
+	// Seq is the sequence number of the event.
+	Seq int `json:"seq"`
+
+	// Type is always 'event'.
+	Type string `json:"type"`
+
+	// Event is the type of the event, e.g. 'stopped'.
+	Event string `json:"event"`
+
+	// Body contains event-specific information.
+	Body map[string]interface{} `json:"body"`
+}
+
 // KernelState represents possible execution states for the kernel.
 // https://jupyter-protocol.readthedocs.io/en/latest/messaging.html#kernel-status
 type KernelState string
@@ -99,42 +243,84 @@ const (
 
 // StatusMessage represents the content of a status message in the Jupyter protocol.
 type StatusMessage struct {
+	Envelope
+
 	// ExecutionState represents the state of the kernel: 'busy', 'idle', 'starting'.
 	ExecutionState KernelState `json:"execution_state"`
 }
 
-func parseContent(msgType string, content json.RawMessage) (interface{}, error) {
-	target, err := createTarget(msgType)
-	if err != nil {
-		return nil, err
+var (
+	// Lock used to register message types.
+	messageTypesLock = new(sync.RWMutex)
+	messageTypes     = make(map[string]func() interface{})
+)
+
+// RegisterMessageType registers a factory of content targets for a custom IOPub message type.
+// The factory must return a pointer that the message content can be unmarshaled into.
+// Types embedding Envelope receive the message header and metadata.
+// Registered types take precedence over the built-in ones.
+// Contents of message types that are neither registered nor built-in are delivered as json.RawMessage.
+func RegisterMessageType(msgType string, factory func() interface{}) {
+	messageTypesLock.Lock()
+	defer messageTypesLock.Unlock()
+	messageTypes[msgType] = factory
+}
+
+func parseContent(msg *RawMessage) (interface{}, error) {
+	target, ok := createTarget(msg.Header.MsgType)
+	if !ok {
+		return append(json.RawMessage(nil), msg.Content...), nil
+	}
+
+	if len(msg.Content) != 0 {
+		if err := json.Unmarshal(msg.Content, target); err != nil {
+			return nil, err
+		}
 	}
 
-	if err := json.Unmarshal(content, target); err != nil {
-		return nil, err
+	if envelope, ok := target.(interface{ setEnvelope(*RawMessage) }); ok {
+		envelope.setEnvelope(msg)
 	}
 
 	return target, nil
 }
 
-func createTarget(msgType string) (interface{}, error) {
+func createTarget(msgType string) (interface{}, bool) {
+	messageTypesLock.RLock()
+	factory, ok := messageTypes[msgType]
+	messageTypesLock.RUnlock()
+	if ok {
+		return factory(), true
+	}
+
 	switch msgType {
 	case "stream":
-		return new(StreamMessage), nil
+		return new(StreamMessage), true
 	case "display_data":
-		return new(DisplayDataMessage), nil
+		return new(DisplayDataMessage), true
 	case "update_display_data":
-		return new(UpdateDisplayDataMessage), nil
+		return new(UpdateDisplayDataMessage), true
 	case "clear_output":
-		return new(ClearOutputMessage), nil
+		return new(ClearOutputMessage), true
 	case "execute_input":
-		return new(ExecuteInputMessage), nil
+		return new(ExecuteInputMessage), true
 	case "execute_result":
-		return new(ExecuteResultMessage), nil
+		return new(ExecuteResultMessage), true
 	case "error":
-		return new(ErrorMessage), nil
+		return new(ErrorMessage), true
 	case "status":
-		return new(StatusMessage), nil
+		return new(StatusMessage), true
+	case "debug_event":
+		return new(DebugEventMessage), true
+	case "comm_open":
+		return new(CommOpenMessage), true
+	case "comm_msg":
+		return new(CommMsgMessage), true
+	case "comm_close":
+		return new(CommCloseMessage), true
+	case "execute_reply":
+		return new(ExecuteReplyMessage), true
 	default:
-		return nil, fmt.Errorf("Unknown message type: %s", msgType)
+		return nil, false
 	}
 }
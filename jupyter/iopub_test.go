@@ -0,0 +1,90 @@
+package jupyter_test
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/crackcomm/go-jupyter/jupyter"
+	"github.com/crackcomm/go-jupyter/jupyter/jupytertest"
+)
+
+// arrivalSeq returns the arrival sequence number of a message published by the fake kernel.
+func arrivalSeq(t *testing.T, msg interface{}) uint64 {
+	switch msg := msg.(type) {
+	case *jupyter.StatusMessage:
+		return msg.ArrivalSeq
+	case *jupyter.StreamMessage:
+		return msg.ArrivalSeq
+	}
+	t.Errorf("unexpected message %T", msg)
+	return 0
+}
+
+func TestArrivalSeqConcurrentExecutions(t *testing.T) {
+	kernel, client := newTestClient(t)
+	kernel.Handle(jupyter.RequestExecute, func(req *jupyter.RawMessage) jupytertest.Reply {
+		reply := jupytertest.Reply{Content: jupyter.ExecutionResult{Status: jupyter.StatusOk}}
+		for i := 0; i < 20; i++ {
+			reply.IOPub = append(reply.IOPub, jupytertest.Output{
+				MsgType: "stream",
+				Content: jupyter.StreamMessage{Name: "stdout", Text: "line\n"},
+			})
+		}
+		return reply
+	})
+	waitForIOPub(t, client)
+	observed := client.Observe()
+	observing := make(chan []uint64)
+	go func() {
+		var seqs []uint64
+		for msg := range observed {
+			seqs = append(seqs, arrivalSeq(t, msg))
+		}
+		observing <- seqs
+	}()
+
+	var (
+		lock  sync.Mutex
+		seen  = make(map[uint64]bool)
+		count int
+	)
+	executions := new(sync.WaitGroup)
+	for i := 0; i < 4; i++ {
+		_, ch, err := client.Execute(&jupyter.ExecutionRequest{Code: "for i in range(20): print('line')"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		executions.Add(1)
+		go func() {
+			defer executions.Done()
+			var last uint64
+			for msg := range ch {
+				seq := arrivalSeq(t, msg)
+				if seq <= last {
+					t.Errorf("arrival sequence %d after %d", seq, last)
+				}
+				last = seq
+				lock.Lock()
+				if seen[seq] {
+					t.Errorf("arrival sequence %d delivered twice", seq)
+				}
+				seen[seq] = true
+				count++
+				lock.Unlock()
+			}
+		}()
+	}
+	executions.Wait()
+	client.Close()
+
+	// busy, 20 streams and idle of each execution
+	if count != 4*22 {
+		t.Fatalf("expected %d messages, got %d", 4*22, count)
+	}
+	seqs := <-observing
+	for i := 1; i < len(seqs); i++ {
+		if seqs[i] != seqs[i-1]+1 {
+			t.Fatalf("observed arrival sequence %d after %d", seqs[i], seqs[i-1])
+		}
+	}
+}
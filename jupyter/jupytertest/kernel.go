@@ -0,0 +1,332 @@
+// Package jupytertest provides utilities for testing code built on the jupyter client
+// without running a real Jupyter kernel.
+package jupytertest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-zeromq/zmq4"
+	"github.com/google/uuid"
+
+	"github.com/crackcomm/go-jupyter/jupyter"
+)
+
+// Output is a message published by the fake kernel on the IOPub channel.
+type Output struct {
+	// MsgType is the type of the published message, e.g. 'stream'.
+	MsgType string
+
+	// Content is the content of the published message.
+	Content interface{}
+}
+
+// Reply is a canned response of the fake kernel to a shell or control request.
+type Reply struct {
+	// MsgType overrides the type of the reply message, by default the request type with a '_reply' suffix.
+	MsgType string
+
+	// Content is the content of the reply message.
+	Content interface{}
+
+	// IOPub contains messages published between the busy and idle status messages.
+	IOPub []Output
+}
+
+// Handler produces a canned reply for a received shell or control request.
+type Handler func(req *jupyter.RawMessage) Reply
+
+// FakeKernel is an in-process kernel listening on loopback ZeroMQ sockets.
+// It answers shell and control requests with canned replies registered with Handle.
+type FakeKernel struct {
+	info      jupyter.ConnectionInfo
+	shell     zmq4.Socket
+	control   zmq4.Socket
+	iopub     zmq4.Socket
+	stdin     zmq4.Socket
+	heartbeat zmq4.Socket
+	signKey   []byte
+	session   string
+	cancel    context.CancelFunc
+
+	lock           *sync.Mutex
+	handlers       map[string]Handler
+	requests       []jupyter.RawMessage
+	executionCount int
+
+	// Routing identities of requests being handled by msg_id, used to send input requests.
+	identities map[string][][]byte
+}
+
+// NewFakeKernel starts a fake kernel listening on random loopback ports.
+// By default it handles execute_request by echoing the code on execute_input.
+func NewFakeKernel(ctx context.Context) (_ *FakeKernel, err error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer func() {
+		if err != nil {
+			cancel()
+		}
+	}()
+	kernel := &FakeKernel{
+		signKey:    []byte(uuid.New().String()),
+		session:    uuid.New().String(),
+		cancel:     cancel,
+		lock:       new(sync.Mutex),
+		handlers:   make(map[string]Handler),
+		identities: make(map[string][][]byte),
+	}
+	kernel.shell = zmq4.NewRouter(ctx)
+	if kernel.info.ShellPort, err = listen(kernel.shell); err != nil {
+		return
+	}
+	kernel.control = zmq4.NewRouter(ctx)
+	if kernel.info.ControlPort, err = listen(kernel.control); err != nil {
+		return
+	}
+	kernel.iopub = zmq4.NewPub(ctx)
+	if kernel.info.IoPubPort, err = listen(kernel.iopub); err != nil {
+		return
+	}
+	kernel.stdin = zmq4.NewRouter(ctx)
+	if kernel.info.StdinPort, err = listen(kernel.stdin); err != nil {
+		return
+	}
+	kernel.heartbeat = zmq4.NewRep(ctx)
+	if kernel.info.HeartBeatPort, err = listen(kernel.heartbeat); err != nil {
+		return
+	}
+	kernel.info.SignatureScheme = "hmac-sha256"
+	kernel.info.Transport = "tcp"
+	kernel.info.IP = "127.0.0.1"
+	kernel.info.Key = string(kernel.signKey)
+	kernel.Handle(jupyter.RequestExecute, kernel.execute)
+	kernel.Handle(jupyter.RequestKernelInfo, kernel.kernelInfo)
+	go kernel.serve(kernel.shell)
+	go kernel.serve(kernel.control)
+	go kernel.serveHeartbeat()
+	return kernel, nil
+}
+
+func listen(socket zmq4.Socket) (int, error) {
+	if err := socket.Listen("tcp://127.0.0.1:0"); err != nil {
+		return 0, err
+	}
+	return socket.Addr().(*net.TCPAddr).Port, nil
+}
+
+// ConnectionInfo returns connection info to pass to jupyter.NewClient.
+func (kernel *FakeKernel) ConnectionInfo() jupyter.ConnectionInfo {
+	return kernel.info
+}
+
+// Handle registers a handler for shell and control requests of the given type, e.g. 'inspect_request'.
+// Requests without a handler are answered with an error reply.
+func (kernel *FakeKernel) Handle(msgType string, handler Handler) {
+	kernel.lock.Lock()
+	defer kernel.lock.Unlock()
+	kernel.handlers[msgType] = handler
+}
+
+// Requests returns all shell and control requests received so far.
+func (kernel *FakeKernel) Requests() []jupyter.RawMessage {
+	kernel.lock.Lock()
+	defer kernel.lock.Unlock()
+	return append([]jupyter.RawMessage(nil), kernel.requests...)
+}
+
+// Close stops the kernel and closes its sockets.
+func (kernel *FakeKernel) Close() error {
+	kernel.cancel()
+	kernel.heartbeat.Close()
+	kernel.control.Close()
+	kernel.stdin.Close()
+	err1 := kernel.shell.Close()
+	err2 := kernel.iopub.Close()
+	if err1 != nil {
+		return err1
+	}
+	return err2
+}
+
+func (kernel *FakeKernel) execute(req *jupyter.RawMessage) Reply {
+	kernel.lock.Lock()
+	kernel.executionCount++
+	count := kernel.executionCount
+	kernel.lock.Unlock()
+
+	var content jupyter.ExecutionRequest
+	_ = json.Unmarshal(req.Content, &content)
+	return Reply{
+		Content: jupyter.ExecutionResult{
+			Status:         jupyter.StatusOk,
+			ExecutionCount: count,
+		},
+		IOPub: []Output{
+			{MsgType: "execute_input", Content: jupyter.ExecuteInputMessage{Code: content.Code, ExecutionCount: count}},
+		},
+	}
+}
+
+func (kernel *FakeKernel) kernelInfo(req *jupyter.RawMessage) Reply {
+	return Reply{
+		Content: jupyter.KernelInfoReply{
+			Status:                string(jupyter.StatusOk),
+			ProtocolVersion:       jupyter.Version,
+			Implementation:        "jupytertest",
+			ImplementationVersion: "0.1",
+			LanguageInfo: jupyter.LanguageInfo{
+				Name:          "fake",
+				Mimetype:      "text/plain",
+				FileExtension: ".txt",
+			},
+			Banner: "Fake kernel",
+		},
+	}
+}
+
+func (kernel *FakeKernel) serve(socket zmq4.Socket) {
+	for {
+		body, err := socket.Recv()
+		if err != nil {
+			return
+		}
+		var req jupyter.RawMessage
+		if err := req.Decode(body.Frames, kernel.signKey); err != nil {
+			continue
+		}
+		ids := identities(body.Frames)
+		kernel.lock.Lock()
+		kernel.requests = append(kernel.requests, req)
+		kernel.identities[req.Header.MsgID] = ids
+		handler, ok := kernel.handlers[req.Header.MsgType]
+		kernel.lock.Unlock()
+
+		var reply Reply
+		if ok {
+			reply = handler(&req)
+		} else {
+			reply.Content = map[string]interface{}{
+				"status": jupyter.StatusError,
+				"ename":  "NotImplementedError",
+				"evalue": fmt.Sprintf("No handler for %s", req.Header.MsgType),
+			}
+		}
+
+		kernel.waitForSubscriber()
+		kernel.publish(&req.Header, "status", jupyter.StatusMessage{ExecutionState: jupyter.StateBusy})
+		for _, output := range reply.IOPub {
+			kernel.publish(&req.Header, output.MsgType, output.Content)
+		}
+		replyType := reply.MsgType
+		if replyType == "" {
+			replyType = strings.TrimSuffix(req.Header.MsgType, "_request") + "_reply"
+		}
+		kernel.lock.Lock()
+		delete(kernel.identities, req.Header.MsgID)
+		kernel.lock.Unlock()
+		if err := kernel.send(socket, ids, &req.Header, replyType, reply.Content); err != nil {
+			return
+		}
+		kernel.publish(&req.Header, "status", jupyter.StatusMessage{ExecutionState: jupyter.StateIdle})
+	}
+}
+
+// Input sends an input_request on the stdin channel to the client of the request and waits for its reply.
+// It can be called by a handler, e.g. to test code reading input.
+func (kernel *FakeKernel) Input(req *jupyter.RawMessage, prompt string, password bool) (string, error) {
+	kernel.lock.Lock()
+	ids, ok := kernel.identities[req.Header.MsgID]
+	kernel.lock.Unlock()
+	if !ok {
+		return "", fmt.Errorf("Request %s is not being handled", req.Header.MsgID)
+	}
+	content := map[string]interface{}{"prompt": prompt, "password": password}
+	if err := kernel.send(kernel.stdin, ids, &req.Header, jupyter.RequestInput, content); err != nil {
+		return "", err
+	}
+	for {
+		body, err := kernel.stdin.Recv()
+		if err != nil {
+			return "", err
+		}
+		var reply jupyter.RawMessage
+		if err := reply.Decode(body.Frames, kernel.signKey); err != nil || reply.Header.MsgType != "input_reply" {
+			continue
+		}
+		var value struct {
+			Value string `json:"value"`
+		}
+		if err := json.Unmarshal(reply.Content, &value); err != nil {
+			return "", err
+		}
+		return value.Value, nil
+	}
+}
+
+func (kernel *FakeKernel) serveHeartbeat() {
+	for {
+		msg, err := kernel.heartbeat.Recv()
+		if err != nil {
+			return
+		}
+		if err := kernel.heartbeat.Send(msg); err != nil {
+			return
+		}
+	}
+}
+
+// waitForSubscriber waits for a client subscription so that published messages are not dropped.
+func (kernel *FakeKernel) waitForSubscriber() {
+	topics, ok := kernel.iopub.(zmq4.Topics)
+	if !ok {
+		return
+	}
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); {
+		if len(topics.Topics()) != 0 {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func (kernel *FakeKernel) publish(parent *jupyter.Header, msgType string, content interface{}) {
+	_ = kernel.send(kernel.iopub, nil, parent, msgType, content)
+}
+
+func (kernel *FakeKernel) send(socket zmq4.Socket, ids [][]byte, parent *jupyter.Header, msgType string, content interface{}) error {
+	msg := jupyter.Message{
+		Header: jupyter.Header{
+			Version:  jupyter.Version,
+			Date:     time.Now().UTC().Format(time.RFC3339),
+			MsgID:    uuid.New().String(),
+			MsgType:  msgType,
+			Username: "kernel",
+			Session:  kernel.session,
+		},
+		ParentHeader: *parent,
+		Metadata:     make(map[string]interface{}),
+		Content:      content,
+	}
+	encoded, err := msg.Encode(kernel.signKey)
+	if err != nil {
+		return err
+	}
+	frames := append(ids, []byte("<IDS|MSG>"))
+	frames = append(frames, encoded...)
+	return socket.SendMulti(zmq4.NewMsgFrom(frames...))
+}
+
+// identities returns the routing frames preceding the message delimiter.
+func identities(frames [][]byte) [][]byte {
+	for i, frame := range frames {
+		if string(frame) == "<IDS|MSG>" {
+			return append([][]byte(nil), frames[:i]...)
+		}
+	}
+	return nil
+}
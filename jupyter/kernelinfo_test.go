@@ -0,0 +1,51 @@
+package jupyter_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/crackcomm/go-jupyter/jupyter"
+	"github.com/crackcomm/go-jupyter/jupyter/jupytertest"
+)
+
+func TestKernelInfoUnexpectedReply(t *testing.T) {
+	kernel, client := newTestClient(t)
+	kernel.Handle(jupyter.RequestKernelInfo, func(req *jupyter.RawMessage) jupytertest.Reply {
+		return jupytertest.Reply{MsgType: "execute_reply", Content: map[string]interface{}{"status": "ok"}}
+	})
+	done := make(chan error, 1)
+	go func() {
+		_, err := client.KernelInfo()
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Fatal("expected an error for an unexpected reply type")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("KernelInfo deadlocked on an unexpected reply type")
+	}
+}
+
+func TestKernelInfoCached(t *testing.T) {
+	kernel, client := newTestClient(t)
+	for i := 0; i < 2; i++ {
+		info, err := client.KernelInfo()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Implementation != "jupytertest" {
+			t.Fatalf("unexpected implementation %q", info.Implementation)
+		}
+	}
+	count := 0
+	for _, req := range kernel.Requests() {
+		if req.Header.MsgType == jupyter.RequestKernelInfo {
+			count++
+		}
+	}
+	if count != 1 {
+		t.Fatalf("expected a single kernel_info_request, got %d", count)
+	}
+}
@@ -0,0 +1,141 @@
+package jupyter
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// KernelSpec describes how to launch a kernel, read from a kernel.json file.
+// https://jupyter-client.readthedocs.io/en/latest/kernels.html#kernel-specs
+type KernelSpec struct {
+	// Argv is a list of command line arguments used to start the kernel.
+	// The text {connection_file} in any argument is replaced with the path to the connection file
+	// and {resource_dir} with ResourceDir, see Args.
+	Argv []string `json:"argv"`
+
+	// DisplayName is the kernel's name as it should be displayed in the UI.
+	DisplayName string `json:"display_name"`
+
+	// Language is the name of the language of the kernel.
+	Language string `json:"language"`
+
+	// Env contains environment variables to set for the kernel.
+	Env map[string]string `json:"env,omitempty"`
+
+	// InterruptMode is either 'signal' or 'message', it defaults to 'signal'.
+	InterruptMode string `json:"interrupt_mode,omitempty"`
+
+	// Metadata contains additional attributes of the kernel.
+	Metadata map[string]interface{} `json:"metadata,omitempty"`
+
+	// ResourceDir is the directory containing the kernel.json file.
+	ResourceDir string `json:"-"`
+}
+
+// Args returns Argv with the {connection_file} and {resource_dir} placeholders replaced.
+func (spec *KernelSpec) Args(connectionFile string) []string {
+	replacer := strings.NewReplacer("{connection_file}", connectionFile, "{resource_dir}", spec.ResourceDir)
+	args := make([]string, len(spec.Argv))
+	for i, arg := range spec.Argv {
+		args[i] = replacer.Replace(arg)
+	}
+	return args
+}
+
+// FindKernelSpec finds an installed kernel spec by name, e.g. 'python3'.
+func FindKernelSpec(name string) (spec KernelSpec, err error) {
+	for _, dir := range kernelDirs() {
+		spec, err = readKernelSpec(filepath.Join(dir, name))
+		if err == nil || !os.IsNotExist(err) {
+			return
+		}
+	}
+	return spec, fmt.Errorf("Kernel spec not found: %s", name)
+}
+
+// ListKernelSpecs returns installed kernel specs by name.
+// Kernel specs are found in the 'kernels' subdirectory of the Jupyter data directories:
+// JUPYTER_PATH, the user data directory (e.g. ~/.local/share/jupyter) and the system directories.
+// If a kernel is installed in several directories, the first one takes precedence.
+func ListKernelSpecs() (map[string]KernelSpec, error) {
+	specs := make(map[string]KernelSpec)
+	for _, dir := range kernelDirs() {
+		entries, err := os.ReadDir(dir)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			if _, ok := specs[entry.Name()]; ok || !entry.IsDir() {
+				continue
+			}
+			spec, err := readKernelSpec(filepath.Join(dir, entry.Name()))
+			if os.IsNotExist(err) {
+				continue
+			} else if err != nil {
+				return nil, fmt.Errorf("Error reading kernel spec %s: %w", entry.Name(), err)
+			}
+			specs[entry.Name()] = spec
+		}
+	}
+	return specs, nil
+}
+
+func readKernelSpec(dir string) (spec KernelSpec, err error) {
+	data, err := os.ReadFile(filepath.Join(dir, "kernel.json"))
+	if err != nil {
+		return
+	}
+	if err = json.Unmarshal(data, &spec); err != nil {
+		return
+	}
+	spec.ResourceDir = dir
+	return
+}
+
+// kernelDirs returns directories containing kernel specs, in order of precedence.
+func kernelDirs() (dirs []string) {
+	for _, dir := range dataDirs() {
+		dirs = append(dirs, filepath.Join(dir, "kernels"))
+	}
+	return
+}
+
+// dataDirs returns Jupyter data directories, in order of precedence.
+// https://docs.jupyter.org/en/latest/use/jupyter-directories.html#data-files
+func dataDirs() (dirs []string) {
+	dirs = append(dirs, filepath.SplitList(os.Getenv("JUPYTER_PATH"))...)
+	dirs = append(dirs, userDataDir())
+	switch runtime.GOOS {
+	case "windows":
+		if programData := os.Getenv("PROGRAMDATA"); programData != "" {
+			dirs = append(dirs, filepath.Join(programData, "jupyter"))
+		}
+	default:
+		dirs = append(dirs, "/usr/local/share/jupyter", "/usr/share/jupyter")
+	}
+	return
+}
+
+func userDataDir() string {
+	if dir := os.Getenv("JUPYTER_DATA_DIR"); dir != "" {
+		return dir
+	}
+	home, _ := os.UserHomeDir()
+	switch runtime.GOOS {
+	case "windows":
+		return filepath.Join(os.Getenv("APPDATA"), "jupyter")
+	case "darwin":
+		return filepath.Join(home, "Library", "Jupyter")
+	default:
+		if dir := os.Getenv("XDG_DATA_HOME"); dir != "" {
+			return filepath.Join(dir, "jupyter")
+		}
+		return filepath.Join(home, ".local", "share", "jupyter")
+	}
+}
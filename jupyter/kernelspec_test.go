@@ -0,0 +1,32 @@
+package jupyter_test
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/crackcomm/go-jupyter/jupyter"
+)
+
+func TestKernelSpecArgs(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("JUPYTER_PATH", dir)
+	resourceDir := filepath.Join(dir, "kernels", "fake")
+	if err := os.MkdirAll(resourceDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	spec := `{"argv": ["fake-kernel", "-f", "{connection_file}", "--rc={resource_dir}/kernelrc"], "display_name": "Fake", "language": "fake"}`
+	if err := os.WriteFile(filepath.Join(resourceDir, "kernel.json"), []byte(spec), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	found, err := jupyter.FindKernelSpec("fake")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"fake-kernel", "-f", "/tmp/kernel-1.json", "--rc=" + resourceDir + "/kernelrc"}
+	if args := found.Args("/tmp/kernel-1.json"); !reflect.DeepEqual(args, expected) {
+		t.Errorf("expected %q, got %q", expected, args)
+	}
+}
@@ -0,0 +1,38 @@
+package jupyter
+
+import "strings"
+
+// LineBuffer accumulates lines of code until the kernel considers them complete.
+// It is meant for console frontends reading code line by line.
+type LineBuffer struct {
+	client *Client
+	lines  []string
+}
+
+// NewLineBuffer creates a line buffer checking completeness with the client.
+func NewLineBuffer(client *Client) *LineBuffer {
+	return &LineBuffer{client: client}
+}
+
+// Feed appends a line to the buffer and asks the kernel whether the buffered code is complete.
+// If it is, the buffered code is returned and the buffer is reset.
+// Otherwise code is the indent hint for the next line.
+// Invalid code is also returned as complete, so that executing it reports the error.
+func (buf *LineBuffer) Feed(line string) (complete bool, code string, err error) {
+	buf.lines = append(buf.lines, line)
+	source := strings.Join(buf.lines, "\n")
+	rep, err := buf.client.IsComplete(&IsCompleteRequest{Code: source})
+	if err != nil {
+		return
+	}
+	if rep.Status == CodeIncomplete {
+		return false, rep.Indent, nil
+	}
+	buf.Reset()
+	return true, source, nil
+}
+
+// Reset discards the buffered lines.
+func (buf *LineBuffer) Reset() {
+	buf.lines = nil
+}
@@ -0,0 +1,149 @@
+package jupyter
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// KernelManager launches a local kernel process from an installed kernel spec.
+type KernelManager struct {
+	// ConnectionDir is the directory where connection files are written.
+	// Defaults to the system temporary directory.
+	ConnectionDir string
+
+	// ShutdownTimeout is the time the kernel process is given to exit before it is killed.
+	// Defaults to five seconds.
+	ShutdownTimeout time.Duration
+
+	cmd            *exec.Cmd
+	exited         chan error
+	client         *Client
+	connectionFile string
+}
+
+// Launch starts the kernel with the given kernel spec name and connects to it.
+// The kernel process is killed when the context is done.
+func (manager *KernelManager) Launch(ctx context.Context, kernelName string, opts ...Option) (_ *Client, err error) {
+	if manager.cmd != nil {
+		return nil, fmt.Errorf("Kernel already launched")
+	}
+	spec, err := FindKernelSpec(kernelName)
+	if err != nil {
+		return
+	}
+	if len(spec.Argv) == 0 {
+		return nil, fmt.Errorf("Kernel spec %s has empty argv", kernelName)
+	}
+	info, err := newLocalConnectionInfo()
+	if err != nil {
+		return
+	}
+	dir := manager.ConnectionDir
+	if dir == "" {
+		dir = os.TempDir()
+	}
+	manager.connectionFile = filepath.Join(dir, fmt.Sprintf("kernel-%s.json", uuid.New()))
+	if err = info.WriteFile(manager.connectionFile); err != nil {
+		return
+	}
+	defer func() {
+		if err != nil {
+			manager.Shutdown()
+		}
+	}()
+
+	argv := spec.Args(manager.connectionFile)
+	cmd := exec.CommandContext(ctx, argv[0], argv[1:]...)
+	cmd.Env = os.Environ()
+	for key, value := range spec.Env {
+		cmd.Env = append(cmd.Env, key+"="+value)
+	}
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err = cmd.Start(); err != nil {
+		return nil, fmt.Errorf("Error starting kernel: %w", err)
+	}
+	manager.cmd = cmd
+	manager.exited = make(chan error, 1)
+	go func() {
+		manager.exited <- cmd.Wait()
+	}()
+
+	if manager.client, err = NewClient(ctx, &info, opts...); err != nil {
+		return
+	}
+	return manager.client, nil
+}
+
+// Shutdown closes the client, terminates the kernel process and removes the connection file.
+func (manager *KernelManager) Shutdown() (err error) {
+	if manager.client != nil {
+		err = manager.client.Close()
+		manager.client = nil
+	}
+	if manager.cmd != nil {
+		if perr := manager.terminate(); perr != nil && err == nil {
+			err = perr
+		}
+		manager.cmd = nil
+	}
+	if manager.connectionFile != "" {
+		os.Remove(manager.connectionFile)
+		manager.connectionFile = ""
+	}
+	return
+}
+
+// terminate asks the kernel process to exit and kills it after the shutdown timeout.
+func (manager *KernelManager) terminate() error {
+	timeout := manager.ShutdownTimeout
+	if timeout == 0 {
+		timeout = 5 * time.Second
+	}
+	if err := manager.cmd.Process.Signal(syscall.SIGTERM); err != nil {
+		return manager.cmd.Process.Kill()
+	}
+	select {
+	case <-manager.exited:
+		return nil
+	case <-time.After(timeout):
+		if err := manager.cmd.Process.Kill(); err != nil {
+			return err
+		}
+		<-manager.exited
+		return nil
+	}
+}
+
+// newLocalConnectionInfo creates connection info with free loopback ports and a random key.
+func newLocalConnectionInfo() (info ConnectionInfo, err error) {
+	info = ConnectionInfo{
+		SignatureScheme: "hmac-sha256",
+		Transport:       "tcp",
+		IP:              "127.0.0.1",
+		Key:             uuid.New().String(),
+	}
+	for _, port := range []*int{&info.StdinPort, &info.ControlPort, &info.IoPubPort, &info.HeartBeatPort, &info.ShellPort} {
+		if *port, err = freePort(); err != nil {
+			return
+		}
+	}
+	return
+}
+
+func freePort() (int, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, err
+	}
+	defer listener.Close()
+	return listener.Addr().(*net.TCPAddr).Port, nil
+}
@@ -1,19 +1,31 @@
 package jupyter
 
 import (
+	"bytes"
 	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha1"
 	"crypto/sha256"
+	"crypto/sha512"
 	"encoding/hex"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"hash"
+	"regexp"
+	"time"
 )
 
 var (
-	// Version of jupyter protocol.
+	// Version of jupyter protocol used by clients by default.
+	// Use WithProtocolVersion to set the version of a single client.
 	Version = "5.3"
 
 	// ErrInvalidSignature is returned when received message with an invalid signature.
 	ErrInvalidSignature = errors.New("Invalid jupyter protocol signature")
+
+	// ErrInvalidHeader is returned by Header.Validate when a header violates the protocol.
+	ErrInvalidHeader = errors.New("Invalid jupyter protocol header")
 )
 
 // https://jupyter-protocol.readthedocs.io/en/latest/messaging.html#general-message-format
@@ -37,6 +49,32 @@ type Header struct {
 	Version string `json:"version"`
 }
 
+// versionPattern matches protocol versions of the form 'X.Y'.
+var versionPattern = regexp.MustCompile(`^[0-9]+\.[0-9]+$`)
+
+// Validate returns an error wrapping ErrInvalidHeader if a required field is empty,
+// the version is not of the form 'X.Y' or the date is not an ISO 8601 timestamp.
+func (header *Header) Validate() error {
+	switch "" {
+	case header.MsgID:
+		return fmt.Errorf("%w: empty msg_id of %s", ErrInvalidHeader, header.MsgType)
+	case header.Session:
+		return fmt.Errorf("%w: empty session of %s", ErrInvalidHeader, header.MsgType)
+	case header.MsgType:
+		return fmt.Errorf("%w: empty msg_type", ErrInvalidHeader)
+	}
+	if !versionPattern.MatchString(header.Version) {
+		return fmt.Errorf("%w: version %q of %s is not of the form X.Y", ErrInvalidHeader, header.Version, header.MsgType)
+	}
+	if _, err := time.Parse(time.RFC3339Nano, header.Date); err != nil {
+		// older kernels send timestamps without a time zone
+		if _, err := time.Parse("2006-01-02T15:04:05.999999999", header.Date); err != nil {
+			return fmt.Errorf("%w: date %q of %s is not an ISO 8601 timestamp", ErrInvalidHeader, header.Date, header.MsgType)
+		}
+	}
+	return nil
+}
+
 // RawMessage represents a Jupyter message structure.
 // https://jupyter-protocol.readthedocs.io/en/latest/messaging.html#general-message-format
 type RawMessage struct {
@@ -52,6 +90,9 @@ type RawMessage struct {
 	// Content is the actual content of the message.
 	// The structure depends on the message type.
 	Content json.RawMessage `json:"content"`
+
+	// Buffers contains the optional binary buffers sent after the content.
+	Buffers [][]byte `json:"-"`
 }
 
 // Message represents a Jupyter message structure.
@@ -71,20 +112,68 @@ type Message struct {
 	Content interface{} `json:"content"`
 }
 
+// MessageOption modifies a request message before it is sent to the kernel.
+type MessageOption func(msg *Message)
+
+// WithMetadata sets the metadata of a request message.
+// Given entries are merged into the message metadata, e.g. JupyterLab sends `cellId` this way.
+func WithMetadata(metadata map[string]interface{}) MessageOption {
+	return func(msg *Message) {
+		if msg.Metadata == nil {
+			msg.Metadata = make(map[string]interface{}, len(metadata))
+		}
+		for key, value := range metadata {
+			msg.Metadata[key] = value
+		}
+	}
+}
+
+// WithMessageUsername overrides the username in the header of a request message.
+func WithMessageUsername(username string) MessageOption {
+	return func(msg *Message) {
+		msg.Header.Username = username
+	}
+}
+
+// SignatureHash returns the hash function of a connection signature scheme, e.g. 'hmac-sha256'.
+// An empty scheme defaults to 'hmac-sha256'.
+func SignatureHash(scheme string) (func() hash.Hash, error) {
+	switch scheme {
+	case "", "hmac-sha256":
+		return sha256.New, nil
+	case "hmac-sha1":
+		return sha1.New, nil
+	case "hmac-sha512":
+		return sha512.New, nil
+	case "hmac-md5":
+		return md5.New, nil
+	default:
+		return nil, fmt.Errorf("Unsupported signature scheme: %s", scheme)
+	}
+}
+
+// Encode encodes the message and signs it with HMAC-SHA256 if signKey is not nil.
 func (msg *Message) Encode(signKey []byte) (parts [][]byte, err error) {
-	parts = make([][]byte, 6)
+	return msg.EncodeWith(signKey, sha256.New)
+}
+
+// EncodeWith encodes the message and signs it with an HMAC using the hash function if signKey is not nil.
+func (msg *Message) EncodeWith(signKey []byte, newHash func() hash.Hash) (parts [][]byte, err error) {
+	parts = make([][]byte, 5)
 
 	for i, v := range []interface{}{msg.Header, msg.ParentHeader, msg.Metadata, msg.Content} {
-		if v != nil {
-			if parts[1+i], err = json.Marshal(v); err != nil {
-				return
-			}
+		if parts[1+i], err = json.Marshal(v); err != nil {
+			return
+		}
+		// Kernels reject missing dict frames, nil metadata or content is sent as an empty dict.
+		if bytes.Equal(parts[1+i], []byte("null")) {
+			parts[1+i] = []byte("{}")
 		}
 	}
 
 	// Sign the message.
 	if signKey != nil {
-		if err = signMessage(parts[1:], signKey, &parts[0]); err != nil {
+		if err = signMessage(parts[1:], signKey, newHash, &parts[0]); err != nil {
 			return
 		}
 	}
@@ -92,8 +181,8 @@ func (msg *Message) Encode(signKey []byte) (parts [][]byte, err error) {
 	return
 }
 
-func signMessage(parts [][]byte, signKey []byte, signature *[]byte) (err error) {
-	mac := hmac.New(sha256.New, signKey)
+func signMessage(parts [][]byte, signKey []byte, newHash func() hash.Hash, signature *[]byte) (err error) {
+	mac := hmac.New(newHash, signKey)
 	for _, part := range parts {
 		mac.Write(part)
 	}
@@ -102,9 +191,15 @@ func signMessage(parts [][]byte, signKey []byte, signature *[]byte) (err error)
 	return
 }
 
+// Decode decodes the message, validating its HMAC-SHA256 signature if signKey is not nil.
 func (msg *Message) Decode(parts [][]byte, signKey []byte) (err error) {
+	return msg.DecodeWith(parts, signKey, sha256.New)
+}
+
+// DecodeWith decodes the message, validating its HMAC signature using the hash function if signKey is not nil.
+func (msg *Message) DecodeWith(parts [][]byte, signKey []byte, newHash func() hash.Hash) (err error) {
 	var raw RawMessage
-	if err = raw.Decode(parts, signKey); err != nil {
+	if err = raw.DecodeWith(parts, signKey, newHash); err != nil {
 		return
 	}
 	if err = json.Unmarshal(raw.Content, &msg.Content); err != nil {
@@ -113,19 +208,31 @@ func (msg *Message) Decode(parts [][]byte, signKey []byte) (err error) {
 	return
 }
 
+// Decode decodes the message, validating its HMAC-SHA256 signature if signKey is not nil.
 func (msg *RawMessage) Decode(parts [][]byte, signKey []byte) error {
+	return msg.DecodeWith(parts, signKey, sha256.New)
+}
+
+// DecodeWith decodes the message, validating its HMAC signature using the hash function if signKey is not nil.
+func (msg *RawMessage) DecodeWith(parts [][]byte, signKey []byte, newHash func() hash.Hash) error {
 	index, err := findIndex(parts, "<IDS|MSG>")
 	if err != nil {
 		return err
 	}
 
 	// Validate signature.
-	if err := validateSignature(parts, index, signKey); err != nil {
+	if err := validateSignature(parts, index, signKey, newHash); err != nil {
 		return err
 	}
 
-	// Unmarshal contents.
-	return unmarshalParts(parts, index+2, &msg.Header, &msg.ParentHeader, &msg.Metadata, &msg.Content)
+	// Unmarshal contents, missing metadata and content frames are left empty.
+	if err := unmarshalParts(parts, index+2, &msg.Header, &msg.ParentHeader, &msg.Metadata, &msg.Content); err != nil {
+		return err
+	}
+	if len(parts) > index+6 {
+		msg.Buffers = parts[index+6:]
+	}
+	return nil
 }
 
 func findIndex(parts [][]byte, target string) (int, error) {
@@ -137,21 +244,34 @@ func findIndex(parts [][]byte, target string) (int, error) {
 	return 0, errors.New("Target not found in parts")
 }
 
-func validateSignature(parts [][]byte, index int, signKey []byte) error {
+func validateSignature(parts [][]byte, index int, signKey []byte, newHash func() hash.Hash) error {
+	// minimal kernels may omit the metadata and content frames
+	if n := len(parts) - index - 1; n < 3 {
+		return fmt.Errorf("Invalid message: expected at least 3 frames after <IDS|MSG>, got %d", n)
+	}
+
 	if signKey == nil {
 		return nil
 	}
 
-	mac := hmac.New(sha256.New, signKey)
-	for _, msgpart := range parts[index+2 : index+6] {
+	end := index + 6
+	if end > len(parts) {
+		end = len(parts)
+	}
+	mac := hmac.New(newHash, signKey)
+	for _, msgpart := range parts[index+2 : end] {
 		mac.Write(msgpart)
 	}
 
 	signature := make([]byte, hex.DecodedLen(len(parts[index+1])))
-	hex.Decode(signature, parts[index+1])
+	if _, err := hex.Decode(signature, parts[index+1]); err != nil {
+		return fmt.Errorf("Invalid signature encoding: %w", err)
+	}
 
 	if !hmac.Equal(mac.Sum(nil), signature) {
-		return ErrInvalidSignature
+		var header Header
+		_ = json.Unmarshal(parts[index+2], &header)
+		return fmt.Errorf("%w (msg_type: %q, <IDS|MSG> index: %d, frames: %d)", ErrInvalidSignature, header.MsgType, index, len(parts))
 	}
 
 	return nil
@@ -159,6 +279,9 @@ func validateSignature(parts [][]byte, index int, signKey []byte) error {
 
 func unmarshalParts(parts [][]byte, startIndex int, values ...interface{}) error {
 	for j, v := range values {
+		if startIndex+j >= len(parts) {
+			break
+		}
 		if parts[startIndex+j] != nil {
 			if err := json.Unmarshal(parts[startIndex+j], v); err != nil {
 				return err
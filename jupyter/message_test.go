@@ -0,0 +1,141 @@
+package jupyter_test
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/crackcomm/go-jupyter/jupyter"
+)
+
+var update = flag.Bool("update", false, "update golden files")
+
+func TestEncodeGolden(t *testing.T) {
+	var (
+		lock  sync.Mutex
+		sent  [][]byte
+		count int
+	)
+	newID := func() string {
+		lock.Lock()
+		defer lock.Unlock()
+		count++
+		return fmt.Sprintf("id-%d", count)
+	}
+	clock := func() time.Time {
+		return time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	}
+	observer := func(direction string, frames [][]byte) {
+		lock.Lock()
+		defer lock.Unlock()
+		if direction == "shell:send" && sent == nil {
+			sent = frames
+		}
+	}
+	_, client := newTestClient(t, jupyter.WithIDGenerator(newID), jupyter.WithClock(clock), jupyter.WithRawObserver(observer))
+	if _, err := client.KernelInfo(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the signature depends on the key of the kernel, it is not compared
+	lock.Lock()
+	got := append(bytes.Join(sent[2:], []byte("\n")), '\n')
+	lock.Unlock()
+	path := filepath.Join("testdata", "kernel_info_request.golden")
+	if *update {
+		if err := os.WriteFile(path, got, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatalf("encoded message differs from %s:\n%s\nwant:\n%s", path, got, want)
+	}
+}
+
+func TestHeaderUsernameAndSession(t *testing.T) {
+	kernel, client := newTestClient(t, jupyter.WithUsername("alice"), jupyter.WithSession("session-1"))
+	if _, err := client.IsComplete(&jupyter.IsCompleteRequest{Code: "x = 1"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.IsComplete(&jupyter.IsCompleteRequest{Code: "x = 1"}, jupyter.WithMessageUsername("bob")); err != nil {
+		t.Fatal(err)
+	}
+	requests := kernel.Requests()
+	if len(requests) != 2 {
+		t.Fatalf("expected 2 requests, got %d", len(requests))
+	}
+	for i, username := range []string{"alice", "bob"} {
+		header := requests[i].Header
+		if header.Username != username || header.Session != "session-1" {
+			t.Errorf("expected username %q and session %q, got %q and %q", username, "session-1", header.Username, header.Session)
+		}
+	}
+}
+
+func TestDecodeSHA1Signed(t *testing.T) {
+	// signed with hmac-sha1 and the key 'secret' by a kernel, not by this package
+	frames := [][]byte{
+		[]byte("kernel-identity"),
+		[]byte("<IDS|MSG>"),
+		[]byte("c2da95981e82f4f6b1eab2d0a8d855c45831eabc"),
+		[]byte(`{"msg_id":"a1","username":"kernel","session":"s1","date":"2024-01-02T03:04:05Z","msg_type":"stream","version":"5.3"}`),
+		[]byte(`{"msg_id":"p1","username":"go-jupyter","session":"s2","date":"2024-01-02T03:04:04Z","msg_type":"execute_request","version":"5.3"}`),
+		[]byte(`{}`),
+		[]byte(`{"name":"stdout","text":"hello\n"}`),
+	}
+	newHash, err := jupyter.SignatureHash("hmac-sha1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var msg jupyter.RawMessage
+	if err := msg.DecodeWith(frames, []byte("secret"), newHash); err != nil {
+		t.Fatal(err)
+	}
+	if msg.Header.MsgType != "stream" || msg.ParentHeader.MsgID != "p1" || string(msg.Content) != `{"name":"stdout","text":"hello\n"}` {
+		t.Fatalf("unexpected message %+v", msg)
+	}
+	if err := msg.DecodeWith(frames, []byte("other"), newHash); !errors.Is(err, jupyter.ErrInvalidSignature) {
+		t.Fatalf("expected an invalid signature with another key, got %v", err)
+	}
+	sha256, _ := jupyter.SignatureHash("hmac-sha256")
+	if err := msg.DecodeWith(frames, []byte("secret"), sha256); !errors.Is(err, jupyter.ErrInvalidSignature) {
+		t.Fatalf("expected an invalid signature with another scheme, got %v", err)
+	}
+}
+
+func TestEncodeNilMetadataAndContent(t *testing.T) {
+	msg := jupyter.Message{
+		Header: jupyter.Header{MsgID: "1", MsgType: jupyter.RequestKernelInfo, Version: jupyter.Version},
+	}
+	key := []byte("secret")
+	encoded, err := msg.Encode(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// signature, header, parent header, metadata and content
+	if len(encoded) != 5 {
+		t.Fatalf("expected 5 frames, got %d", len(encoded))
+	}
+	for i, frame := range encoded[1:] {
+		if len(frame) == 0 {
+			t.Errorf("frame %d is empty", i+1)
+		}
+	}
+	var decoded jupyter.RawMessage
+	if err := decoded.Decode(append([][]byte{[]byte("<IDS|MSG>")}, encoded...), key); err != nil {
+		t.Fatal(err)
+	}
+	if string(decoded.Content) != "{}" || decoded.Metadata == nil || len(decoded.Metadata) != 0 || decoded.Buffers != nil {
+		t.Fatalf("unexpected message %+v", decoded)
+	}
+}
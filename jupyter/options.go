@@ -0,0 +1,209 @@
+package jupyter
+
+import (
+	"context"
+	"time"
+)
+
+// Option configures a Client created with NewClient.
+type Option func(client *Client)
+
+// WithStoreHistory makes non-silent executions store history,
+// following the protocol default for `store_history`.
+func WithStoreHistory() Option {
+	return func(client *Client) {
+		client.storeHistory = true
+	}
+}
+
+// WithIOPubHWM limits the number of received IOPub messages waiting for delivery to n,
+// e.g. when the channel of an execution isn't received from. Messages received while the queue is full
+// are dropped and counted, see Client.DroppedIOPubMessages. The limit is applied by the client,
+// as the SUB socket doesn't support a high-water mark; by default polling waits for each delivery.
+func WithIOPubHWM(n int) Option {
+	return func(client *Client) {
+		client.iopubHWM = n
+	}
+}
+
+// WithConnectRetry makes NewClient retry dialing the kernel up to the given number of attempts,
+// doubling the delay after each failed attempt, until the kernel is up or the context is done.
+// This is useful when connecting to a kernel that was just launched and may not be listening yet.
+func WithConnectRetry(attempts int, delay time.Duration) Option {
+	return func(client *Client) {
+		client.connectAttempts = attempts
+		client.connectDelay = delay
+	}
+}
+
+// WithDialTimeout bounds each attempt of dialing the kernel sockets,
+// independently of deadlines of requests sent later.
+// Without it, dialing an unreachable address relies on TCP timeouts which may take minutes.
+func WithDialTimeout(d time.Duration) Option {
+	return func(client *Client) {
+		client.dialTimeout = d
+	}
+}
+
+// WithRecvTimeout bounds the time to wait for replies on the control channel, e.g. to Interrupt and Shutdown,
+// and for heartbeat echoes, so priority requests fail fast with context.DeadlineExceeded if the kernel is wedged.
+// Shell requests are not affected, as executions may take arbitrarily long.
+func WithRecvTimeout(d time.Duration) Option {
+	return func(client *Client) {
+		client.recvTimeout = d
+	}
+}
+
+// WithExecutionTimeout bounds the time an execution may take until the kernel reports idle status,
+// so callers don't wait forever on a kernel that crashed mid-execution.
+// An execution timing out is handled like ExecuteContext with a cancelled context:
+// the kernel is interrupted if it did not reply yet, and the channel of IOPub messages
+// is closed without the final idle StatusMessage.
+func WithExecutionTimeout(d time.Duration) Option {
+	return func(client *Client) {
+		client.executionTimeout = d
+	}
+}
+
+// WithKernelInfoOnConnect requests kernel info when connecting, before any other request is sent.
+// The reply is cached and returned by KernelInfo.
+func WithKernelInfoOnConnect() Option {
+	return func(client *Client) {
+		client.kernelInfoOnConnect = true
+	}
+}
+
+// WithSocketFactory sets the factory creating the kernel sockets, it defaults to go-zeromq sockets.
+func WithSocketFactory(factory SocketFactory) Option {
+	return func(client *Client) {
+		client.sockets = factory
+	}
+}
+
+// WithConnectionFileReload reloads the connection file at the path and reconnects to the kernel
+// after n consecutive messages with invalid signatures, e.g. when a restarted kernel
+// reuses the connection file with a new key. Requests waiting for a reply fail with ErrReconnected,
+// as with Reconnect. Messages with invalid signatures published on IOPub are dropped.
+func WithConnectionFileReload(path string, n int) Option {
+	return func(client *Client) {
+		if n < 1 {
+			n = 1
+		}
+		client.reloadPath = path
+		client.reloadAfter = n
+	}
+}
+
+// WithStrictValidation validates headers of sent and received messages, see Header.Validate,
+// e.g. when testing a kernel against the protocol. Requests fail with an error wrapping ErrInvalidHeader
+// if a message violates the protocol, an invalid IOPub message is dropped as any message failing to decode.
+func WithStrictValidation() Option {
+	return func(client *Client) {
+		client.strict = true
+	}
+}
+
+// WithProtocolVersion sets the protocol version sent in message headers, it defaults to Version.
+func WithProtocolVersion(version string) Option {
+	return func(client *Client) {
+		client.version = version
+	}
+}
+
+// WithUsername sets the username sent in message headers, it defaults to "go-jupyter".
+// Gateways may use it to tag, route or authorize messages of an end user.
+func WithUsername(username string) Option {
+	return func(client *Client) {
+		client.username = username
+	}
+}
+
+// WithSession sets the session identifier sent in message headers, it defaults to a random UUID.
+func WithSession(session string) Option {
+	return func(client *Client) {
+		client.session = session
+	}
+}
+
+// WithIDGenerator sets the generator of message, session and comm identifiers, it defaults to random UUIDs.
+// A deterministic generator and WithClock make encoded messages reproducible, e.g. in golden-file tests.
+func WithIDGenerator(newID func() string) Option {
+	return func(client *Client) {
+		client.newID = newID
+	}
+}
+
+// WithClock sets the clock of message header dates, it defaults to time.Now.
+func WithClock(now func() time.Time) Option {
+	return func(client *Client) {
+		client.now = now
+	}
+}
+
+// WithIdentity sets the ZeroMQ identity of the shell socket, it defaults to the session identifier.
+// Routers and proxies route replies by the socket identity.
+func WithIdentity(identity []byte) Option {
+	return func(client *Client) {
+		client.identity = identity
+	}
+}
+
+// WithSessionFilter drops IOPub messages published for requests of other sessions,
+// e.g. of other clients of a shared kernel, before their content is parsed.
+// It is a client-side filter only: kernels publish on topics derived from the message type
+// rather than the session, so the SUB socket still receives and decodes all messages.
+// Messages without a parent, e.g. status published on kernel startup, are dropped as well.
+// Observe only receives messages of this client.
+func WithSessionFilter() Option {
+	return func(client *Client) {
+		client.sessionFilter = true
+	}
+}
+
+// WithIOPubSubscribe sets the IOPub topic prefixes to subscribe to.
+// An empty prefix subscribes to all messages, which is the default.
+// With no prefixes the client doesn't receive any IOPub messages.
+func WithIOPubSubscribe(prefixes ...string) Option {
+	return func(client *Client) {
+		client.subscriptions = append([]string{}, prefixes...)
+	}
+}
+
+// WithRawObserver sets a function called with the raw frames, signature included,
+// of every message sent and received by the client, e.g. to record a session.
+// The direction is the channel name followed by ":send" or ":recv", e.g. "shell:send" or "iopub:recv".
+// The observer is called from multiple goroutines and must not modify the frames.
+func WithRawObserver(observer func(direction string, frames [][]byte)) Option {
+	return func(client *Client) {
+		client.rawObserver = observer
+	}
+}
+
+// Tracer starts a span for a request round-trip on the shell or control channel.
+// The returned function ends the span with the request error, which is nil on success.
+// It is called from the goroutine sending the request, so the span may be a child
+// of a span carried by the request context, e.g. with an OpenTelemetry adapter:
+//
+//	func (t otelTracer) StartRequest(ctx context.Context, channel, msgType, msgID string) func(error) {
+//		_, span := t.Start(ctx, msgType, trace.WithAttributes(
+//			attribute.String("jupyter.channel", channel),
+//			attribute.String("jupyter.msg_id", msgID),
+//		))
+//		return func(err error) {
+//			if err != nil {
+//				span.RecordError(err)
+//				span.SetStatus(codes.Error, err.Error())
+//			}
+//			span.End()
+//		}
+//	}
+type Tracer interface {
+	StartRequest(ctx context.Context, channel, msgType, msgID string) (end func(err error))
+}
+
+// WithTracer traces each request sent on the shell or control channel until its reply is received.
+func WithTracer(tracer Tracer) Option {
+	return func(client *Client) {
+		client.tracer = tracer
+	}
+}
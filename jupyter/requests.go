@@ -1,13 +1,23 @@
 package jupyter
 
 var (
-	RequestExecute = "execute_request"
-	RequestInspect = "inspect_request"
-	RequestHistory = "history_request"
+	RequestExecute    = "execute_request"
+	RequestInspect    = "inspect_request"
+	RequestHistory    = "history_request"
+	RequestKernelInfo = "kernel_info_request"
+	RequestIsComplete = "is_complete_request"
+	RequestConnect    = "connect_request"
+	RequestDebug      = "debug_request"
+	RequestInterrupt  = "interrupt_request"
+	RequestShutdown   = "shutdown_request"
+	RequestInput      = "input_request"
 )
 
 // ExecutionRequest represents a request to execute source code by the kernel.
 // https://jupyter-protocol.readthedocs.io/en/latest/messaging.html#execute
+//
+// All fields are always sent, as the protocol defaults of StoreHistory, AllowStdin and StopOnError
+// differ from their zero values.
 type ExecutionRequest struct {
 	// Code to be executed by the kernel, one or more lines.
 	Code string `json:"code"`
@@ -17,22 +27,42 @@ type ExecutionRequest struct {
 	Silent bool `json:"silent"`
 
 	// StoreHistory, if true, signals the kernel to populate history.
-	// Defaults to true if Silent is false.
+	// The protocol defaults to true if Silent is false, but the zero value here is false.
+	// Use WithStoreHistory to follow the protocol default. It is always false if Silent is true.
 	StoreHistory bool `json:"store_history"`
 
 	// UserExpressions is a map of names to expressions to be evaluated in the user's dict.
 	// The rich display-data representation of each will be evaluated after execution.
 	// See the display_data content for the structure of the representation data.
+	// A nil map is sent as an empty dict.
 	UserExpressions map[string]string `json:"user_expressions"`
 
 	// AllowStdin, if true, indicates that the code running in the kernel can prompt the user for input.
+	// It is set if OnInput is set.
 	AllowStdin bool `json:"allow_stdin"`
 
-	// StopOnError, if true, does not abort the execution queue if an exception is encountered.
-	// Allows queued execution of multiple execute_requests, even if they generate exceptions.
+	// StopOnError, if true, aborts the execution queue if an exception is encountered:
+	// execute_requests queued after this one are not executed and reply with status 'aborted'.
+	// If false, queued execute_requests are executed even if this one generates an exception.
+	// The protocol defaults to true, but the zero value here is false.
 	StopOnError bool `json:"stop_on_error"`
+
+	// OnInput answers input requests of the execution, e.g. reading from a terminal or a file.
+	// Prompts are answered with empty input if it is nil and AllowStdin is set.
+	// It is not called if the kernel has no stdin port.
+	OnInput InputHandler `json:"-"`
 }
 
+// Detail levels of an introspection request.
+const (
+	// DetailLevelDefault is equivalent to typing 'x?' at the IPython prompt.
+	DetailLevelDefault = 0
+
+	// DetailLevelSource is equivalent to typing 'x??' at the IPython prompt,
+	// it includes the source code if available.
+	DetailLevelSource = 1
+)
+
 // IntrospectionRequest represents a request for code introspection.
 // https://jupyter-protocol.readthedocs.io/en/latest/messaging.html#introspection
 type IntrospectionRequest struct {
@@ -43,7 +73,7 @@ type IntrospectionRequest struct {
 	// CursorPos is the cursor position within 'Code' (in Unicode characters) where inspection is requested.
 	CursorPos int `json:"cursor_pos"`
 
-	// DetailLevel is the level of detail desired.
+	// DetailLevel is the level of detail desired, either DetailLevelDefault or DetailLevelSource.
 	// In IPython, 0 is equivalent to typing 'x?' at the prompt, 1 is equivalent to 'x??'.
 	// The difference is up to kernels, but in IPython, level 1 includes the source code if available.
 	DetailLevel int `json:"detail_level"`
@@ -61,6 +91,7 @@ type CompleteRequest struct {
 }
 
 // HistoryRequest represents the content of a history_request message in the Jupyter protocol.
+// Fields not used by the access type are sent with zero values and ignored by kernels.
 type HistoryRequest struct {
 	// Output indicates whether to return output history in the resulting dictionary.
 	Output bool `json:"output"`
@@ -89,3 +120,10 @@ type HistoryRequest struct {
 	// If HistAccessType is 'search' and Unique is true, do not include duplicated history. Default is false.
 	Unique bool `json:"unique"`
 }
+
+// IsCompleteRequest represents the content of an is_complete_request message in the Jupyter protocol.
+// https://jupyter-protocol.readthedocs.io/en/latest/messaging.html#code-completeness
+type IsCompleteRequest struct {
+	// Code entered so far as a multiline string.
+	Code string `json:"code"`
+}
@@ -3,6 +3,8 @@ package jupyter
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
+	"math"
 )
 
 // Status represents possible status values for reply messages.
@@ -20,8 +22,27 @@ const (
 	// StatusAbort indicates that the request is aborted.
 	// Deprecated in version 5.1; kernels should send StatusError instead.
 	StatusAbort Status = "abort"
+
+	// StatusAborted indicates that the request is aborted, as sent by ipykernel.
+	StatusAborted Status = "aborted"
 )
 
+// KernelError is an exception raised in the kernel while processing a request.
+type KernelError struct {
+	// EName is the exception name, as a string.
+	EName string `json:"ename"`
+
+	// EValue is the exception value, as a string.
+	EValue string `json:"evalue"`
+
+	// Traceback is a list of traceback frames as strings.
+	Traceback []string `json:"traceback"`
+}
+
+func (err *KernelError) Error() string {
+	return fmt.Sprintf("%s: %s", err.EName, err.EValue)
+}
+
 // ExecutionResult represents the result of a code execution request.
 // https://jupyter-protocol.readthedocs.io/en/latest/messaging.html#execution-results
 type ExecutionResult struct {
@@ -39,6 +60,99 @@ type ExecutionResult struct {
 
 	// UserExpressions contains results for user_expressions if the status is 'ok'.
 	UserExpressions map[string]DisplayData `json:"user_expressions,omitempty"`
+
+	// EName is the exception name if the status is 'error'.
+	EName string `json:"ename,omitempty"`
+
+	// EValue is the exception value if the status is 'error'.
+	EValue string `json:"evalue,omitempty"`
+
+	// Traceback is a list of traceback frames if the status is 'error'.
+	Traceback []string `json:"traceback,omitempty"`
+
+	// Result is the data of the execute_result message published by the execution.
+	// It is only set by ExecuteAndWait, if the execution produced a result.
+	Result *DisplayData `json:"-"`
+}
+
+// ErrExecutionAborted is returned by ExecutionResult.Err when the execution was aborted,
+// e.g. because an earlier execution failed with StopOnError.
+var ErrExecutionAborted = errors.New("Execution aborted")
+
+// UnmarshalJSON implements the json.Unmarshaler interface for ExecutionResult,
+// accepting an execution count encoded as a float, see executionCount.
+func (r *ExecutionResult) UnmarshalJSON(data []byte) error {
+	type plain ExecutionResult
+	parsed := struct {
+		*plain
+		ExecutionCount executionCount `json:"execution_count"`
+	}{plain: (*plain)(r)}
+	if err := json.Unmarshal(data, &parsed); err != nil {
+		return err
+	}
+	r.ExecutionCount = int(parsed.ExecutionCount)
+	return nil
+}
+
+// executionCount is an execution count encoded as an integer or as an integral float, e.g. 3.0,
+// as sent by kernels whose JSON encoders don't distinguish integers. Null is decoded as zero.
+type executionCount int
+
+func (count *executionCount) UnmarshalJSON(data []byte) error {
+	var n int
+	if err := json.Unmarshal(data, &n); err == nil {
+		*count = executionCount(n)
+		return nil
+	}
+	var f float64
+	if err := json.Unmarshal(data, &f); err != nil {
+		return err
+	}
+	if f != math.Trunc(f) || math.Abs(f) > 1<<53 {
+		return fmt.Errorf("Invalid execution count: %s", data)
+	}
+	*count = executionCount(f)
+	return nil
+}
+
+// OK returns true if the execution succeeded, see Err.
+func (r ExecutionResult) OK() bool {
+	return r.Status == StatusOk
+}
+
+// Err returns nil if the execution succeeded, ErrExecutionAborted if it was aborted,
+// or a *KernelError describing the exception raised by the execution.
+func (r ExecutionResult) Err() error {
+	switch r.Status {
+	case StatusOk:
+		return nil
+	case StatusAbort, StatusAborted:
+		return ErrExecutionAborted
+	default:
+		return &KernelError{EName: r.EName, EValue: r.EValue, Traceback: r.Traceback}
+	}
+}
+
+// Expression returns the result of the user expression with the name, if it was evaluated.
+func (r ExecutionResult) Expression(name string) (DisplayData, bool) {
+	data, ok := r.UserExpressions[name]
+	return data, ok
+}
+
+// Pages returns the MIME bundles of 'page' payloads, e.g. the help shown for `x?` in IPython.
+func (r ExecutionResult) Pages() (pages []DisplayData) {
+	for _, payload := range r.Payload {
+		if payload["source"] != "page" {
+			continue
+		}
+		if data, ok := payload["data"].(map[string]interface{}); ok {
+			pages = append(pages, DisplayData{Data: data})
+		} else if text, ok := payload["text"].(string); ok {
+			// payloads before protocol 5.0 carry plain text
+			pages = append(pages, DisplayData{Data: map[string]interface{}{"text/plain": text}})
+		}
+	}
+	return
 }
 
 // DisplayData represents a message type for displaying data.
@@ -70,6 +184,29 @@ type InspectReply struct {
 
 	// Metadata is a dictionary containing additional metadata associated with the inspection result.
 	Metadata map[string]interface{} `json:"metadata"`
+
+	// EName is the exception name if the status is 'error'.
+	EName string `json:"ename,omitempty"`
+
+	// EValue is the exception value if the status is 'error'.
+	EValue string `json:"evalue,omitempty"`
+
+	// Traceback is a list of traceback frames if the status is 'error'.
+	Traceback []string `json:"traceback,omitempty"`
+}
+
+// OK returns true if the kernel inspected the code, it may have found no object, see Found and Err.
+func (r InspectReply) OK() bool {
+	return Status(r.Status) == StatusOk
+}
+
+// Err returns a *KernelError if the kernel failed to inspect the code, nil otherwise.
+// A reply without an error may still have found nothing, see Found.
+func (r InspectReply) Err() error {
+	if Status(r.Status) != StatusError {
+		return nil
+	}
+	return &KernelError{EName: r.EName, EValue: r.EValue, Traceback: r.Traceback}
 }
 
 // CompleteReply represents the content of a complete_reply message in the Jupyter protocol.
@@ -91,61 +228,307 @@ type CompleteReply struct {
 	// Status should be 'ok' unless an exception was raised during the request.
 	// If there is an error, Status will be 'error' along with the usual error message content.
 	Status string `json:"status"`
+
+	// EName is the exception name if the status is 'error'.
+	EName string `json:"ename,omitempty"`
+
+	// EValue is the exception value if the status is 'error'.
+	EValue string `json:"evalue,omitempty"`
+
+	// Traceback is a list of traceback frames if the status is 'error'.
+	Traceback []string `json:"traceback,omitempty"`
+}
+
+// OK returns true if the kernel completed the code, it may have no matches. See Err.
+func (r CompleteReply) OK() bool {
+	return Status(r.Status) == StatusOk
+}
+
+// Err returns a *KernelError if the kernel failed to complete the code, nil otherwise.
+func (r CompleteReply) Err() error {
+	if Status(r.Status) != StatusError {
+		return nil
+	}
+	return &KernelError{EName: r.EName, EValue: r.EValue, Traceback: r.Traceback}
 }
 
 // HistoryItem represents a single history item with session, line number, and optional output.
+// It is encoded as `[session, line_number, input]` or, if output was requested,
+// as `[session, line_number, [input, output]]` where output may be null.
 type HistoryItem struct {
+	// Session is the number of the kernel session the input was executed in.
+	// Requests for negative sessions are answered with absolute session numbers.
 	Session    int
 	LineNumber int
 	Input      string
 	Output     interface{}
+
+	// HasOutput is true if the input is paired with an output, which may be nil.
+	HasOutput bool
 }
 
 // HistoryReply represents the content of a history_reply message in the Jupyter protocol.
 type HistoryReply struct {
 	// History is a list of history items.
 	History []HistoryItem `json:"history"`
+
+	// Status should be 'ok' unless an exception was raised during the request,
+	// e.g. for an invalid access type.
+	Status string `json:"status"`
+
+	// EName is the exception name if the status is 'error'.
+	EName string `json:"ename,omitempty"`
+
+	// EValue is the exception value if the status is 'error'.
+	EValue string `json:"evalue,omitempty"`
+
+	// Traceback is a list of traceback frames if the status is 'error'.
+	Traceback []string `json:"traceback,omitempty"`
+}
+
+// Err returns a *KernelError if the kernel failed to access the history, nil otherwise.
+// A failed request has no history items, which is not to be confused with an empty history.
+func (r HistoryReply) Err() error {
+	if Status(r.Status) != StatusError {
+		return nil
+	}
+	return &KernelError{EName: r.EName, EValue: r.EValue, Traceback: r.Traceback}
+}
+
+// BySession groups the history items by the kernel session they were executed in,
+// preserving their order. Sessions are numbered by the kernel, counting up each time it starts.
+func (r HistoryReply) BySession() map[int][]HistoryItem {
+	sessions := make(map[int][]HistoryItem)
+	for _, item := range r.History {
+		sessions[item.Session] = append(sessions[item.Session], item)
+	}
+	return sessions
 }
 
 // UnmarshalJSON implements the json.Unmarshaler interface for HistoryItem.
 func (item *HistoryItem) UnmarshalJSON(data []byte) error {
-	var raw []interface{}
+	var raw []json.RawMessage
 	if err := json.Unmarshal(data, &raw); err != nil {
 		return err
 	}
 
-	if len(raw) < 3 {
+	if len(raw) != 3 {
 		return errors.New("invalid history item format")
 	}
 
-	item.Session, _ = raw[0].(int)
-	item.LineNumber, _ = raw[1].(int)
-	item.Input, _ = raw[2].(string)
+	*item = HistoryItem{}
+	if err := json.Unmarshal(raw[0], &item.Session); err != nil {
+		return err
+	}
+	if err := json.Unmarshal(raw[1], &item.LineNumber); err != nil {
+		return err
+	}
 
-	if len(raw) > 3 {
-		item.Output = raw[3]
+	if err := json.Unmarshal(raw[2], &item.Input); err == nil {
+		return nil
 	}
 
-	if input, ok := raw[2].(string); ok {
-		item.Input = input
-	} else if tup, ok := raw[2].([]interface{}); ok && len(tup) == 2 {
-		item.Input, _ = tup[0].(string)
-		item.Output, _ = tup[1].(string)
+	var tup []interface{}
+	if err := json.Unmarshal(raw[2], &tup); err != nil || len(tup) != 2 {
+		return errors.New("invalid history item format")
 	}
+	input, ok := tup[0].(string)
+	if !ok {
+		return errors.New("invalid history item input")
+	}
+	item.Input = input
+	item.Output = tup[1]
+	item.HasOutput = true
 
 	return nil
 }
 
 // MarshalJSON implements the json.Marshaler interface for HistoryItem.
-func (item *HistoryItem) MarshalJSON() ([]byte, error) {
-	var raw []interface{}
-	raw = append(raw, item.Session, item.LineNumber)
+func (item HistoryItem) MarshalJSON() ([]byte, error) {
+	raw := []interface{}{item.Session, item.LineNumber}
 
-	if item.Output == nil {
-		raw = append(raw, item.Input)
-	} else {
+	if item.HasOutput || item.Output != nil {
 		raw = append(raw, []interface{}{item.Input, item.Output})
+	} else {
+		raw = append(raw, item.Input)
 	}
 
 	return json.Marshal(raw)
 }
+
+// CompletenessStatus represents possible statuses of an is_complete_reply message.
+type CompletenessStatus string
+
+const (
+	// CodeComplete indicates that the code is ready to be executed.
+	CodeComplete CompletenessStatus = "complete"
+
+	// CodeIncomplete indicates that the code should prompt for another line.
+	CodeIncomplete CompletenessStatus = "incomplete"
+
+	// CodeInvalid indicates that the code will typically be sent for execution, so that the user sees the error soonest.
+	CodeInvalid CompletenessStatus = "invalid"
+
+	// CodeUnknown indicates that the kernel could not determine the completeness,
+	// the frontend should also handle the kernel not replying promptly.
+	CodeUnknown CompletenessStatus = "unknown"
+)
+
+// IsCompleteReply represents the content of an is_complete_reply message in the Jupyter protocol.
+type IsCompleteReply struct {
+	// Status is one of 'complete', 'incomplete', 'invalid', 'unknown'.
+	Status CompletenessStatus `json:"status"`
+
+	// Indent is a hint for the frontend about how to indent the next line, if Status is 'incomplete'.
+	Indent string `json:"indent"`
+}
+
+// ShutdownReply represents the content of a shutdown_reply message in the Jupyter protocol.
+// https://jupyter-protocol.readthedocs.io/en/latest/messaging.html#kernel-shutdown
+type ShutdownReply struct {
+	// Status is 'ok' if the kernel is shutting down, or 'error'.
+	Status Status `json:"status"`
+
+	// Restart is true if the kernel is restarting after the shutdown.
+	Restart bool `json:"restart"`
+}
+
+// ConnectReply represents the content of a connect_reply message in the Jupyter protocol.
+// Deprecated in the protocol in favor of connection files, but still exposed by some kernel proxies.
+// https://jupyter-protocol.readthedocs.io/en/latest/messaging.html#connect
+type ConnectReply struct {
+	// ShellPort is the port the shell ROUTER socket is listening on.
+	ShellPort int `json:"shell_port"`
+
+	// IoPubPort is the port the PUB socket is listening on.
+	IoPubPort int `json:"iopub_port"`
+
+	// StdinPort is the port the stdin ROUTER socket is listening on.
+	StdinPort int `json:"stdin_port"`
+
+	// HeartBeatPort is the port the heartbeat socket is listening on.
+	HeartBeatPort int `json:"hb_port"`
+
+	// ControlPort is the port the control ROUTER socket is listening on.
+	ControlPort int `json:"control_port"`
+}
+
+// KernelInfoReply represents the content of a kernel_info_reply message in the Jupyter protocol.
+// https://jupyter-protocol.readthedocs.io/en/latest/messaging.html#kernel-info
+type KernelInfoReply struct {
+	// Status should be 'ok' unless an exception was raised during the request.
+	Status string `json:"status"`
+
+	// ProtocolVersion is the version of the messaging protocol used by the kernel.
+	ProtocolVersion string `json:"protocol_version"`
+
+	// Implementation is the kernel implementation name (e.g. 'ipython').
+	Implementation string `json:"implementation"`
+
+	// ImplementationVersion is the implementation version number of the kernel.
+	ImplementationVersion string `json:"implementation_version"`
+
+	// LanguageInfo contains information about the language of code for the kernel.
+	LanguageInfo LanguageInfo `json:"language_info"`
+
+	// Banner is a banner of information about the kernel, which may be displayed in console environments.
+	Banner string `json:"banner"`
+
+	// Debugger is true if the kernel supports debugging in the notebook.
+	Debugger bool `json:"debugger"`
+
+	// HelpLinks is a list of links to be added to the help menu in notebook frontends.
+	HelpLinks []HelpLink `json:"help_links"`
+}
+
+// HelpLink is a link to be added to the help menu in notebook frontends.
+type HelpLink struct {
+	// Text is the title of the link.
+	Text string `json:"text"`
+
+	// URL is the address of the link.
+	URL string `json:"url"`
+}
+
+// LanguageInfo contains information about the language of code for the kernel.
+type LanguageInfo struct {
+	// Name of the programming language that the kernel implements.
+	Name string `json:"name"`
+
+	// Version is the language version number.
+	Version string `json:"version"`
+
+	// Mimetype for script files in this language.
+	Mimetype string `json:"mimetype"`
+
+	// FileExtension including the dot, e.g. '.py'.
+	FileExtension string `json:"file_extension"`
+
+	// PygmentsLexer is the Pygments lexer, for highlighting. Only needed if it differs from Name.
+	PygmentsLexer string `json:"pygments_lexer,omitempty"`
+
+	// CodeMirrorMode is the codemirror mode, for highlighting in the notebook.
+	// Only needed if it differs from Name.
+	CodeMirrorMode CodeMirrorMode `json:"codemirror_mode"`
+
+	// NbconvertExporter is the nbconvert exporter, if notebooks written with this kernel
+	// should be exported with something other than the general 'script' exporter.
+	NbconvertExporter string `json:"nbconvert_exporter,omitempty"`
+}
+
+// CodeMirrorMode is the codemirror mode of a language.
+// Kernels send it either as a string (e.g. 'ipython') or as an object (e.g. {"name": "ipython", "version": 3}).
+type CodeMirrorMode struct {
+	// Name of the codemirror mode.
+	Name string `json:"name"`
+
+	// Version of the mode, if sent as an object.
+	Version int `json:"version,omitempty"`
+
+	// Extra contains other options of the mode sent as an object, e.g. 'highlightFormatting'.
+	Extra map[string]interface{} `json:"-"`
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface for CodeMirrorMode.
+// The mode is sent either as a name, e.g. "ipython", or as an object, e.g. {"name": "ipython", "version": 3}.
+func (mode *CodeMirrorMode) UnmarshalJSON(data []byte) error {
+	var name string
+	if err := json.Unmarshal(data, &name); err == nil {
+		*mode = CodeMirrorMode{Name: name}
+		return nil
+	}
+
+	type plain CodeMirrorMode
+	var parsed plain
+	if err := json.Unmarshal(data, &parsed); err != nil {
+		return err
+	}
+	var extra map[string]interface{}
+	if err := json.Unmarshal(data, &extra); err != nil {
+		return err
+	}
+	delete(extra, "name")
+	delete(extra, "version")
+	if len(extra) != 0 {
+		parsed.Extra = extra
+	}
+	*mode = CodeMirrorMode(parsed)
+	return nil
+}
+
+// MarshalJSON implements the json.Marshaler interface for CodeMirrorMode.
+// A mode with only a name is encoded as a string.
+func (mode CodeMirrorMode) MarshalJSON() ([]byte, error) {
+	if mode.Version == 0 && len(mode.Extra) == 0 {
+		return json.Marshal(mode.Name)
+	}
+	object := make(map[string]interface{}, len(mode.Extra)+2)
+	for key, value := range mode.Extra {
+		object[key] = value
+	}
+	object["name"] = mode.Name
+	if mode.Version != 0 {
+		object["version"] = mode.Version
+	}
+	return json.Marshal(object)
+}
@@ -0,0 +1,174 @@
+package jupyter_test
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/crackcomm/go-jupyter/jupyter"
+	"github.com/crackcomm/go-jupyter/jupyter/jupytertest"
+)
+
+func TestHistoryReplyErr(t *testing.T) {
+	kernel, client := newTestClient(t)
+	kernel.Handle(jupyter.RequestHistory, func(req *jupyter.RawMessage) jupytertest.Reply {
+		var content jupyter.HistoryRequest
+		_ = json.Unmarshal(req.Content, &content)
+		switch content.HistAccessType {
+		case "range", "tail", "search":
+			return jupytertest.Reply{Content: map[string]interface{}{"status": "ok", "history": []interface{}{}}}
+		}
+		return jupytertest.Reply{Content: map[string]interface{}{
+			"status": "error",
+			"ename":  "ValueError",
+			"evalue": "Unknown hist_access_type: " + content.HistAccessType,
+		}}
+	})
+	rep, err := client.History(&jupyter.HistoryRequest{HistAccessType: "tail", N: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := rep.Err(); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	rep, err = client.History(&jupyter.HistoryRequest{HistAccessType: "invalid"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var kernelErr *jupyter.KernelError
+	if err := rep.Err(); !errors.As(err, &kernelErr) || kernelErr.EName != "ValueError" {
+		t.Fatalf("expected a ValueError, got %v", err)
+	}
+}
+
+func TestExecutionCountEncodings(t *testing.T) {
+	decoders := map[string]func(data []byte) (int, error){
+		"ExecutionResult": func(data []byte) (int, error) {
+			var rep jupyter.ExecutionResult
+			err := json.Unmarshal(data, &rep)
+			return rep.ExecutionCount, err
+		},
+		"ExecuteInputMessage": func(data []byte) (int, error) {
+			var msg jupyter.ExecuteInputMessage
+			err := json.Unmarshal(data, &msg)
+			return msg.ExecutionCount, err
+		},
+		"ExecuteResultMessage": func(data []byte) (int, error) {
+			var msg jupyter.ExecuteResultMessage
+			err := json.Unmarshal(data, &msg)
+			return msg.ExecutionCount, err
+		},
+	}
+	for _, test := range []struct {
+		count string
+		want  int
+		err   bool
+	}{
+		{count: "7", want: 7},
+		{count: "7.0", want: 7},
+		{count: "1e3", want: 1000},
+		{count: "null", want: 0},
+		{count: "4294967296", want: 1 << 32},
+		{count: "9007199254740992.0", want: 1 << 53},
+		{count: "2.5", err: true},
+		{count: "1e300", err: true},
+		{count: `"7"`, err: true},
+	} {
+		data := []byte(`{"status": "ok", "execution_count": ` + test.count + `}`)
+		for name, decode := range decoders {
+			count, err := decode(data)
+			if test.err {
+				if err == nil {
+					t.Errorf("%s: expected an error decoding %s, got %d", name, test.count, count)
+				}
+				continue
+			}
+			if err != nil {
+				t.Errorf("%s: error decoding %s: %v", name, test.count, err)
+			} else if count != test.want {
+				t.Errorf("%s: expected %d decoding %s, got %d", name, test.want, test.count, count)
+			}
+		}
+	}
+}
+
+func TestCodeMirrorMode(t *testing.T) {
+	for _, test := range []struct {
+		mode string
+		want jupyter.CodeMirrorMode
+	}{
+		{`"ipython"`, jupyter.CodeMirrorMode{Name: "ipython"}},
+		{`{"name": "ipython", "version": 3}`, jupyter.CodeMirrorMode{Name: "ipython", Version: 3}},
+		{`{"name": "gfm", "highlightFormatting": true}`, jupyter.CodeMirrorMode{Name: "gfm", Extra: map[string]interface{}{"highlightFormatting": true}}},
+	} {
+		var info jupyter.LanguageInfo
+		if err := json.Unmarshal([]byte(`{"name": "python", "codemirror_mode": `+test.mode+`}`), &info); err != nil {
+			t.Fatalf("error decoding %s: %v", test.mode, err)
+		}
+		if !reflect.DeepEqual(info.CodeMirrorMode, test.want) {
+			t.Errorf("expected %+v decoding %s, got %+v", test.want, test.mode, info.CodeMirrorMode)
+		}
+		encoded, err := json.Marshal(info.CodeMirrorMode)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var mode, want interface{}
+		_ = json.Unmarshal(encoded, &mode)
+		_ = json.Unmarshal([]byte(test.mode), &want)
+		if !reflect.DeepEqual(mode, want) {
+			t.Errorf("expected %s encoding %+v, got %s", test.mode, info.CodeMirrorMode, encoded)
+		}
+	}
+}
+
+func TestHistoryItemRoundTrip(t *testing.T) {
+	for _, test := range []struct {
+		item string
+		want jupyter.HistoryItem
+	}{
+		{`[1, 2, "x = 1"]`, jupyter.HistoryItem{Session: 1, LineNumber: 2, Input: "x = 1"}},
+		{`[1, 3, ["x", "1"]]`, jupyter.HistoryItem{Session: 1, LineNumber: 3, Input: "x", Output: "1", HasOutput: true}},
+		{`[2, 1, ["x = 1", null]]`, jupyter.HistoryItem{Session: 2, LineNumber: 1, Input: "x = 1", HasOutput: true}},
+	} {
+		var item jupyter.HistoryItem
+		if err := json.Unmarshal([]byte(test.item), &item); err != nil {
+			t.Fatalf("error decoding %s: %v", test.item, err)
+		}
+		if !reflect.DeepEqual(item, test.want) {
+			t.Errorf("expected %+v decoding %s, got %+v", test.want, test.item, item)
+		}
+		encoded, err := json.Marshal(item)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got, want interface{}
+		_ = json.Unmarshal(encoded, &got)
+		_ = json.Unmarshal([]byte(test.item), &want)
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("expected %s encoding %+v, got %s", test.item, item, encoded)
+		}
+	}
+	var item jupyter.HistoryItem
+	if err := json.Unmarshal([]byte(`[1, 2]`), &item); err == nil {
+		t.Error("expected an error decoding an item without input")
+	}
+}
+
+func TestInspectReplyOK(t *testing.T) {
+	for _, test := range []struct {
+		rep jupyter.InspectReply
+		ok  bool
+	}{
+		{jupyter.InspectReply{Status: "ok", Found: true}, true},
+		{jupyter.InspectReply{Status: "ok", Found: false}, true},
+		{jupyter.InspectReply{Status: "error", EName: "NameError"}, false},
+	} {
+		if ok := test.rep.OK(); ok != test.ok {
+			t.Errorf("expected OK %v of %+v", test.ok, test.rep)
+		}
+		if ok := test.rep.Err() == nil; ok != test.ok {
+			t.Errorf("expected OK %v consistent with Err of %+v", test.ok, test.rep)
+		}
+	}
+}
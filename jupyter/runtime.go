@@ -0,0 +1,48 @@
+package jupyter
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// RuntimeDir returns the Jupyter runtime directory containing connection files of running kernels.
+// It is JUPYTER_RUNTIME_DIR if set, otherwise the 'runtime' subdirectory of the user data directory.
+// https://docs.jupyter.org/en/latest/use/jupyter-directories.html#runtime-files
+func RuntimeDir() string {
+	if dir := os.Getenv("JUPYTER_RUNTIME_DIR"); dir != "" {
+		return dir
+	}
+	return filepath.Join(userDataDir(), "runtime")
+}
+
+// ConnectionInfoByKernelID reads the connection file of a running kernel with the given id,
+// i.e. kernel-<id>.json in the runtime directory.
+func ConnectionInfoByKernelID(id string) (ConnectionInfo, error) {
+	return ReadConfigFile(filepath.Join(RuntimeDir(), "kernel-"+id+".json"))
+}
+
+// MostRecentKernel reads the most recently modified connection file in the runtime directory,
+// like `jupyter console --existing` without a kernel id. The kernel may no longer be running.
+func MostRecentKernel() (ConnectionInfo, error) {
+	paths, err := filepath.Glob(filepath.Join(RuntimeDir(), "kernel-*.json"))
+	if err != nil {
+		return ConnectionInfo{}, err
+	}
+	var latest string
+	var latestTime time.Time
+	for _, path := range paths {
+		stat, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		if latest == "" || stat.ModTime().After(latestTime) {
+			latest, latestTime = path, stat.ModTime()
+		}
+	}
+	if latest == "" {
+		return ConnectionInfo{}, fmt.Errorf("No kernel connection files in %s", RuntimeDir())
+	}
+	return ReadConfigFile(latest)
+}
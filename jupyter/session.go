@@ -0,0 +1,47 @@
+package jupyter
+
+import "context"
+
+// Session is a kernel launched from an installed kernel spec with a connected client,
+// running code and evaluating expressions without handling messages.
+// The low-level client is available with Client.
+type Session struct {
+	manager *KernelManager
+	client  *Client
+}
+
+// NewSession launches a kernel with the kernel spec name, e.g. 'python3', and connects to it.
+// The kernel process is killed when the context is done.
+func NewSession(ctx context.Context, kernelName string, opts ...Option) (*Session, error) {
+	manager := new(KernelManager)
+	client, err := manager.Launch(ctx, kernelName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &Session{manager: manager, client: client}, nil
+}
+
+// Client returns the client connected to the session kernel.
+func (session *Session) Client() *Client {
+	return session.client
+}
+
+// Run executes the code storing history and waits until the kernel reports idle status, see Client.Run.
+// If the execution failed, the output is returned with a *KernelError or ErrExecutionAborted.
+func (session *Session) Run(code string) (ExecutionOutput, error) {
+	out, err := session.client.Run(&ExecutionRequest{Code: code, StoreHistory: true})
+	if err != nil {
+		return out, err
+	}
+	return out, out.Reply.Err()
+}
+
+// Eval evaluates the expression in the kernel and returns its rich representation.
+func (session *Session) Eval(expr string) (DisplayData, error) {
+	return session.client.Eval(expr)
+}
+
+// Close shuts down the kernel, see KernelManager.Shutdown.
+func (session *Session) Close() error {
+	return session.manager.Shutdown()
+}
@@ -0,0 +1,35 @@
+package jupyter
+
+import (
+	"context"
+
+	"github.com/go-zeromq/zmq4"
+)
+
+// SocketFactory creates the ZeroMQ sockets of a client,
+// e.g. to inject mock sockets in tests or to wrap the default go-zeromq sockets.
+type SocketFactory interface {
+	// NewDealer creates a shell, control or stdin socket.
+	NewDealer(ctx context.Context, opts ...zmq4.Option) zmq4.Socket
+
+	// NewSub creates an IOPub socket.
+	NewSub(ctx context.Context, opts ...zmq4.Option) zmq4.Socket
+
+	// NewReq creates a heartbeat socket.
+	NewReq(ctx context.Context, opts ...zmq4.Option) zmq4.Socket
+}
+
+// zmqSockets creates go-zeromq sockets.
+type zmqSockets struct{}
+
+func (zmqSockets) NewDealer(ctx context.Context, opts ...zmq4.Option) zmq4.Socket {
+	return zmq4.NewDealer(ctx, opts...)
+}
+
+func (zmqSockets) NewSub(ctx context.Context, opts ...zmq4.Option) zmq4.Socket {
+	return zmq4.NewSub(ctx, opts...)
+}
+
+func (zmqSockets) NewReq(ctx context.Context, opts ...zmq4.Option) zmq4.Socket {
+	return zmq4.NewReq(ctx, opts...)
+}
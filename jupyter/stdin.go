@@ -0,0 +1,84 @@
+package jupyter
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+)
+
+// InputHandler answers a prompt of code reading input, e.g. `input()` in Python.
+// If password is true, the input should not be echoed.
+// An error interrupts the kernel, as if the user pressed Ctrl-C at the prompt.
+type InputHandler func(prompt string, password bool) (string, error)
+
+// inputRequest is the content of an input_request message sent by the kernel on the stdin channel.
+type inputRequest struct {
+	Prompt   string `json:"prompt"`
+	Password bool   `json:"password"`
+}
+
+// setInputHandler registers the input handler of the execution, a nil handler removes it.
+func (client *Client) setInputHandler(id string, handler InputHandler) {
+	client.inputLock.Lock()
+	defer client.inputLock.Unlock()
+	if handler == nil {
+		delete(client.inputHandlers, id)
+	} else {
+		client.inputHandlers[id] = handler
+	}
+}
+
+func (client *Client) getInputHandler(id string) (handler InputHandler, ok bool) {
+	client.inputLock.Lock()
+	defer client.inputLock.Unlock()
+	handler, ok = client.inputHandlers[id]
+	return
+}
+
+// pollStdin receives input requests and answers them with the input handler of the execution
+// matched by parent header msg_id. Requests of executions without a handler are answered with empty input.
+func (client *Client) pollStdin(ctx context.Context) {
+	for {
+		var msg RawMessage
+		frames, err := client.stdin.recv(&msg)
+		if frames == nil {
+			return
+		}
+		if err != nil {
+			log.Printf("Dropped stdin message: %v", err)
+			continue
+		}
+		if msg.Header.MsgType != RequestInput {
+			continue
+		}
+		var req inputRequest
+		if err := json.Unmarshal(msg.Content, &req); err != nil {
+			log.Printf("Error decoding input request: %v", err)
+			continue
+		}
+		handler, ok := client.getInputHandler(msg.ParentHeader.MsgID)
+		if !ok {
+			handler = func(string, bool) (string, error) { return "", nil }
+		}
+		// handlers may wait for a user, so they don't block polling
+		go client.answerInput(ctx, msg.Header, req, handler)
+	}
+}
+
+// answerInput sends the input returned by the handler in an input_reply to the request,
+// or interrupts the kernel if the handler failed.
+func (client *Client) answerInput(ctx context.Context, parent Header, req inputRequest, handler InputHandler) {
+	value, err := handler(req.Prompt, req.Password)
+	if ctx.Err() != nil {
+		return
+	}
+	if err != nil {
+		_ = client.control.send(client.createMessage(RequestInterrupt, struct{}{}))
+		return
+	}
+	reply := client.createMessage("input_reply", map[string]interface{}{"value": value})
+	reply.ParentHeader = parent
+	if err := client.stdin.send(reply); err != nil {
+		log.Printf("Error sending input reply: %v", err)
+	}
+}
@@ -0,0 +1,41 @@
+package jupyter
+
+import (
+	"io"
+	"strings"
+)
+
+// Stream names of a stream message.
+const (
+	StreamStdout = "stdout"
+	StreamStderr = "stderr"
+)
+
+// SplitStreams concatenates the text of stream messages by stream name, preserving their order.
+// Other messages are ignored.
+func SplitStreams(msgs []interface{}) (stdout, stderr string) {
+	var outBuf, errBuf strings.Builder
+	for _, msg := range msgs {
+		WriteStream(msg, &outBuf, &errBuf)
+	}
+	return outBuf.String(), errBuf.String()
+}
+
+// WriteStream writes the text of a stream message to stdout or stderr according to its name.
+// Other messages and streams with a nil writer are ignored.
+// It can be called for each message received on the channel to forward output in real time.
+func WriteStream(msg interface{}, stdout, stderr io.Writer) error {
+	stream, ok := msg.(*StreamMessage)
+	if !ok {
+		return nil
+	}
+	w := stdout
+	if stream.Name == StreamStderr {
+		w = stderr
+	}
+	if w == nil {
+		return nil
+	}
+	_, err := io.WriteString(w, stream.Text)
+	return err
+}
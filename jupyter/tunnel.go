@@ -0,0 +1,137 @@
+package jupyter
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+)
+
+// Dialer dials addresses on a remote host, e.g. *ssh.Client from golang.org/x/crypto/ssh.
+type Dialer interface {
+	Dial(network, addr string) (net.Conn, error)
+}
+
+// Tunnel forwards local loopback ports to the ports of a remote kernel.
+type Tunnel struct {
+	dialer    Dialer
+	listeners []net.Listener
+	wg        *sync.WaitGroup
+
+	// Lock used to track forwarded connections.
+	lock   *sync.Mutex
+	conns  map[net.Conn]struct{}
+	closed bool
+}
+
+// NewTunnel listens on a local loopback port for each port of the remote kernel
+// and forwards connections to the kernel through the dialer, e.g. an SSH connection.
+// Returned connection info points at the local ports and can be passed to NewClient.
+// Remote addresses are resolved by the dialer, so a kernel listening on its loopback interface is reachable.
+func NewTunnel(dialer Dialer, remote ConnectionInfo) (_ *Tunnel, local ConnectionInfo, err error) {
+	if remote.Transport != "tcp" {
+		return nil, local, fmt.Errorf("Unsupported tunnel transport: %s", remote.Transport)
+	}
+	tunnel := &Tunnel{
+		dialer: dialer,
+		wg:     new(sync.WaitGroup),
+		lock:   new(sync.Mutex),
+		conns:  make(map[net.Conn]struct{}),
+	}
+	defer func() {
+		if err != nil {
+			tunnel.Close()
+		}
+	}()
+	local = remote
+	local.IP = "127.0.0.1"
+	for _, port := range []*int{&local.StdinPort, &local.ControlPort, &local.IoPubPort, &local.HeartBeatPort, &local.ShellPort} {
+		if *port == 0 {
+			continue
+		}
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			return nil, local, fmt.Errorf("Tunnel listen error: %w", err)
+		}
+		tunnel.listeners = append(tunnel.listeners, listener)
+		tunnel.wg.Add(1)
+		go tunnel.serve(listener, net.JoinHostPort(remote.IP, strconv.Itoa(*port)))
+		*port = listener.Addr().(*net.TCPAddr).Port
+	}
+	return tunnel, local, nil
+}
+
+// Close stops listening on local ports and closes forwarded connections.
+// Clients using the tunnel should be closed first.
+func (tunnel *Tunnel) Close() error {
+	for _, listener := range tunnel.listeners {
+		listener.Close()
+	}
+	tunnel.lock.Lock()
+	tunnel.closed = true
+	for conn := range tunnel.conns {
+		conn.Close()
+	}
+	tunnel.lock.Unlock()
+	tunnel.wg.Wait()
+	return nil
+}
+
+func (tunnel *Tunnel) serve(listener net.Listener, addr string) {
+	defer tunnel.wg.Done()
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		tunnel.wg.Add(1)
+		go tunnel.forward(conn, addr)
+	}
+}
+
+func (tunnel *Tunnel) forward(conn net.Conn, addr string) {
+	defer tunnel.wg.Done()
+	defer conn.Close()
+	remote, err := tunnel.dialer.Dial("tcp", addr)
+	if err != nil {
+		return
+	}
+	defer remote.Close()
+	if !tunnel.track(conn, remote) {
+		return
+	}
+	defer tunnel.untrack(conn, remote)
+	done := make(chan struct{}, 2)
+	go func() {
+		io.Copy(remote, conn)
+		done <- struct{}{}
+	}()
+	go func() {
+		io.Copy(conn, remote)
+		done <- struct{}{}
+	}()
+	// closing both connections after either direction ends unblocks the other copy
+	<-done
+}
+
+// track registers forwarded connections to be closed with the tunnel, it returns false if the tunnel is closed.
+func (tunnel *Tunnel) track(conns ...net.Conn) bool {
+	tunnel.lock.Lock()
+	defer tunnel.lock.Unlock()
+	if tunnel.closed {
+		return false
+	}
+	for _, conn := range conns {
+		tunnel.conns[conn] = struct{}{}
+	}
+	return true
+}
+
+func (tunnel *Tunnel) untrack(conns ...net.Conn) {
+	tunnel.lock.Lock()
+	defer tunnel.lock.Unlock()
+	for _, conn := range conns {
+		delete(tunnel.conns, conn)
+	}
+}